@@ -2,18 +2,18 @@ package main
 
 import (
 	"context"
-	"crypto/rsa"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"sso-server/internal/database"
+	"sso-server/internal/helper"
 	"sso-server/internal/server"
 	"strconv"
 	"syscall"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	_ "github.com/joho/godotenv/autoload"
 )
 
@@ -44,14 +44,17 @@ func gracefulShutdown(fiberServer *server.FiberServer, done chan bool) {
 
 func main() {
 
-	privKey, pubKey, err := loadKeys()
+	keys, err := loadKeys()
 	if err != nil {
-		log.Fatal("Could not load RSA KEYS", err)
+		log.Fatal("Could not load signing keys: ", err)
 	}
-	server := server.New(privKey, pubKey)
+	server := server.New(keys)
 	errDB := database.New().SeedPermissionsAndRoles()
 	if errDB != nil {
-		log.Fatal(err)
+		log.Fatal(errDB)
+	}
+	if err := database.New().SeedClients(); err != nil {
+		log.Fatal("Could not seed OAuth clients: ", err)
 	}
 	server.RegisterFiberRoutes()
 
@@ -73,23 +76,75 @@ func main() {
 	log.Println("Graceful shutdown complete.")
 }
 
-func loadKeys() (*rsa.PrivateKey, *rsa.PublicKey, error) {
-	privKeyData, err := os.ReadFile(os.Getenv("RSA_PRIVATE_KEY_PATH"))
-	if err != nil {
-		return nil, nil, err
+// keyConfig is one entry of the SIGNING_KEYS_FILE JSON array. Entries with
+// only a public key are kept for verification of tokens signed before a
+// rotation; not_before schedules when a new key takes over signing.
+type keyConfig struct {
+	Algorithm      string    `json:"algorithm"`
+	PrivateKeyPath string    `json:"private_key_path"`
+	PublicKeyPath  string    `json:"public_key_path"`
+	NotBefore      time.Time `json:"not_before"`
+	NotAfter       time.Time `json:"not_after"`
+}
+
+func loadKeys() (*helper.KeySet, error) {
+	overlap := 24 * time.Hour
+	if raw := os.Getenv("KEY_ROTATION_OVERLAP"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KEY_ROTATION_OVERLAP: %w", err)
+		}
+		overlap = d
 	}
-	privKey, err := jwt.ParseRSAPrivateKeyFromPEM(privKeyData)
-	if err != nil {
-		return nil, nil, err
+
+	configs := []keyConfig{{
+		Algorithm:      os.Getenv("SIGNING_KEY_ALGORITHM"),
+		PrivateKeyPath: os.Getenv("RSA_PRIVATE_KEY_PATH"),
+		PublicKeyPath:  os.Getenv("RSA_PUBLIC_KEY_PATH"),
+	}}
+	if path := os.Getenv("SIGNING_KEYS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		configs = nil
+		if err := json.Unmarshal(data, &configs); err != nil {
+			return nil, err
+		}
 	}
-	pubKeyData, err := os.ReadFile(os.Getenv("RSA_PUBLIC_KEY_PATH"))
-	if err != nil {
-		return nil, nil, err
+
+	keys := make([]*helper.SigningKey, 0, len(configs))
+	for _, cfg := range configs {
+		key := &helper.SigningKey{Algorithm: cfg.Algorithm, NotBefore: cfg.NotBefore, NotAfter: cfg.NotAfter}
+		if cfg.PrivateKeyPath != "" {
+			privKeyData, err := os.ReadFile(cfg.PrivateKeyPath)
+			if err != nil {
+				return nil, err
+			}
+			key.PrivateKey, err = helper.ParsePrivateKeyPEM(privKeyData)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if cfg.PublicKeyPath != "" {
+			pubKeyData, err := os.ReadFile(cfg.PublicKeyPath)
+			if err != nil {
+				return nil, err
+			}
+			key.PublicKey, err = helper.ParsePublicKeyPEM(pubKeyData)
+			if err != nil {
+				return nil, err
+			}
+		}
+		keys = append(keys, key)
+		fmt.Printf("Loaded keys from %s and %s\n", cfg.PrivateKeyPath, cfg.PublicKeyPath)
 	}
-	pubKey, err := jwt.ParseRSAPublicKeyFromPEM(pubKeyData)
+	keySet, err := helper.NewKeySet(overlap, keys...)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	if _, err := keySet.SigningKey(); err != nil {
+		return nil, err
 	}
-	fmt.Printf("Loaded keys from %s and %s\n", os.Getenv("RSA_PRIVATE_KEY_PATH"), os.Getenv("RSA_PUBLIC_KEY_PATH"))
-	return privKey, pubKey, nil
+	return keySet, nil
 }
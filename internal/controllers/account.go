@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"sso-server/internal/dto"
+	"sso-server/internal/helper"
+	"sso-server/internal/mail"
+	"sso-server/internal/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// emailChange is a pending address change, stored in Redis under the hash of
+// the token mailed to the new address.
+type emailChange struct {
+	UserID   string `json:"user_id"`
+	OldEmail string `json:"old_email"`
+	NewEmail string `json:"new_email"`
+	// SID is the session that asked for the change; it stays signed in.
+	SID string `json:"sid"`
+}
+
+func emailChangeKey(token string) string {
+	return "email_change:" + helper.HashToken(token)
+}
+
+// accountUser loads the user behind the bearer token. When the user is nil
+// the error response has already been written.
+func (ac *AuthController) accountUser(c *fiber.Ctx) (*models.User, error) {
+	claimed, err := helper.GetUserFromContext(c)
+	if err != nil {
+		return nil, c.Status(403).JSON(fiber.Map{"message": err.Error()})
+	}
+	var user models.User
+	if err := ac.DB.First(&user, "id = ?", claimed.ID).Error; err != nil || user.Disabled() {
+		return nil, c.Status(401).JSON(fiber.Map{"message": "account is no longer active"})
+	}
+	return &user, nil
+}
+
+const (
+	maxCurrentPasswordFailures = 5
+	currentPasswordLockout     = 15 * time.Minute
+)
+
+// currentPasswordFailuresKey counts wrong current_password attempts per user,
+// so a stolen access token cannot be used to guess the password.
+func currentPasswordFailuresKey(userID uuid.UUID) string {
+	return "current_password_failures:" + userID.String()
+}
+
+// checkCurrentPassword verifies the current password of a signed-in user.
+// After maxCurrentPasswordFailures wrong attempts it refuses to check for
+// currentPasswordLockout. When it returns false the error response has
+// already been written.
+func (ac *AuthController) checkCurrentPassword(c *fiber.Ctx, user *models.User, password string) (bool, error) {
+	key := currentPasswordFailuresKey(user.ID)
+	if failures, _ := ac.Redis.Get(c.Context(), key).Int(); failures >= maxCurrentPasswordFailures {
+		return false, c.Status(429).JSON(fiber.Map{"message": "too many incorrect passwords, try again later"})
+	}
+	if !helper.ComparePassword(user.PasswordHash, password) {
+		pipe := ac.Redis.TxPipeline()
+		pipe.Incr(c.Context(), key)
+		pipe.Expire(c.Context(), key, currentPasswordLockout)
+		pipe.Exec(c.Context())
+		return false, c.Status(403).JSON(fiber.Map{"message": "current password is incorrect"})
+	}
+	ac.Redis.Del(c.Context(), key)
+	return true, nil
+}
+
+// ChangePassword sets a new password after checking the current one. Every
+// other session of the user is signed out.
+func (ac *AuthController) ChangePassword(c *fiber.Ctx) error {
+	user, err := ac.accountUser(c)
+	if user == nil {
+		return err
+	}
+	var req dto.ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	if errs := validateStruct(req); errs != nil {
+		return c.Status(400).JSON(fiber.Map{"message": "validation error", "errors": errs})
+	}
+	if ok, err := ac.checkCurrentPassword(c, user, req.CurrentPassword); !ok {
+		return err
+	}
+	if err := ac.DB.Model(user).Update("password_hash", helper.GeneratePassword(req.Password)).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not change password"})
+	}
+	if err := ac.endOtherUserSessions(c.Context(), user.ID, helper.GetSessionIDFromContext(c)); err != nil {
+		log.Printf("ending sessions after password change for %s: %v", user.ID, err)
+	}
+	go ac.sendMail(user.Email, "Your password was changed",
+		"The password for your account was just changed and your other sessions were signed out.\n\n"+
+			"If this was not you, reset your password immediately at "+os.Getenv("APP_URL")+"/forgot-password.")
+	return c.JSON(fiber.Map{"message": "password changed"})
+}
+
+// ChangeEmail starts an address change. The new address only takes effect
+// once the link mailed to it is opened; the old address is told about the
+// request.
+func (ac *AuthController) ChangeEmail(c *fiber.Ctx) error {
+	user, err := ac.accountUser(c)
+	if user == nil {
+		return err
+	}
+	var req dto.ChangeEmailRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	if errs := validateStruct(req); errs != nil {
+		return c.Status(400).JSON(fiber.Map{"message": "validation error", "errors": errs})
+	}
+	if ok, err := ac.checkCurrentPassword(c, user, req.CurrentPassword); !ok {
+		return err
+	}
+	if strings.EqualFold(req.Email, user.Email) {
+		return c.Status(400).JSON(fiber.Map{"message": "this is already your email address"})
+	}
+	if ac.emailTaken(req.Email) {
+		return c.Status(409).JSON(fiber.Map{"message": "email address is already in use"})
+	}
+
+	token, err := helper.GenerateOpaqueToken()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not start email change"})
+	}
+	data, _ := json.Marshal(emailChange{
+		UserID:   user.ID.String(),
+		OldEmail: user.Email,
+		NewEmail: req.Email,
+		SID:      helper.GetSessionIDFromContext(c),
+	})
+	if err := ac.Redis.Set(c.Context(), emailChangeKey(token), data, helper.EmailVerificationTTL).Err(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not start email change"})
+	}
+
+	link := os.Getenv("APP_URL") + "/confirm-email-change?" + url.Values{"token": {token}}.Encode()
+	go ac.sendMail(req.Email, "Confirm your new email address",
+		"Open this link to use this address for your account:\n"+link+"\n\n"+
+			"The link expires in "+helper.EmailVerificationTTL.String()+". If you did not ask for this, you can ignore this email.")
+	go ac.sendMail(user.Email, "Your email address is being changed",
+		"Someone signed in to your account asked to change its email address to "+req.Email+".\n\n"+
+			"Nothing changes until the new address is confirmed. If this was not you, change your password now.")
+	return c.Status(202).JSON(fiber.Map{"message": "confirmation sent to " + req.Email})
+}
+
+// ConfirmEmailChange applies a pending email change from the link sent to
+// the new address, marks it verified and signs out the user's other
+// sessions.
+func (ac *AuthController) ConfirmEmailChange(c *fiber.Ctx) error {
+	failed := func(msg string) error {
+		return c.Status(400).Render("verify_email", fiber.Map{
+			"AppUrl":   os.Getenv("APP_URL"),
+			"Error":    msg,
+			"Verified": true,
+		})
+	}
+	data, err := ac.Redis.GetDel(c.Context(), emailChangeKey(c.Query("token"))).Bytes()
+	var change emailChange
+	if err == nil {
+		err = json.Unmarshal(data, &change)
+	}
+	userID, parseErr := uuid.Parse(change.UserID)
+	if err != nil || parseErr != nil {
+		return failed("This confirmation link is invalid or has expired.")
+	}
+
+	res := ac.DB.Model(&models.User{}).
+		Where("id = ? AND email = ?", userID, change.OldEmail).
+		Updates(map[string]interface{}{
+			"email":             change.NewEmail,
+			"email_verified_at": time.Now(),
+		})
+	if res.Error != nil {
+		return failed("This address could not be used. It may already belong to another account.")
+	}
+	if res.RowsAffected == 0 {
+		return failed("Your email address has changed since this link was sent.")
+	}
+	if err := ac.endOtherUserSessions(c.Context(), userID, change.SID); err != nil {
+		log.Printf("ending sessions after email change for %s: %v", userID, err)
+	}
+	return c.Render("verify_email", fiber.Map{
+		"AppUrl":   os.Getenv("APP_URL"),
+		"Message":  "Your email address is now " + change.NewEmail + ".",
+		"Verified": true,
+	})
+}
+
+func (ac *AuthController) emailTaken(email string) bool {
+	var count int64
+	ac.DB.Unscoped().Model(&models.User{}).Where("LOWER(email) = LOWER(?)", email).Count(&count)
+	return count > 0
+}
+
+// sendMail delivers a message in the background; failures are only logged
+// since the request that triggered it has already been answered.
+func (ac *AuthController) sendMail(to, subject, body string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := ac.Mailer.Send(ctx, mail.Message{To: to, Subject: subject, Body: body}); err != nil {
+		log.Printf("sending %q mail: %v", subject, err)
+	}
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AdminController serves the /admin API. Routes are mounted behind
+// AuthMiddleware and the Administrator role guard.
+type AdminController struct {
+	DB *gorm.DB
+	// Auth is used to end the sessions of users who are disabled or deleted.
+	Auth *AuthController
+}
+
+// paramID parses a uuid route parameter.
+func paramID(c *fiber.Ctx, name string) (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Params(name))
+	if err != nil {
+		return uuid.Nil, errors.New("invalid " + name)
+	}
+	return id, nil
+}
+
+// notFoundOr500 maps a lookup error to 404 for missing records and 500
+// otherwise.
+func notFoundOr500(c *fiber.Ctx, err error, what string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(404).JSON(fiber.Map{"message": what + " not found"})
+	}
+	return c.Status(500).JSON(fiber.Map{"message": "could not load " + what})
+}
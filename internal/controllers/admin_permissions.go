@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"sso-server/internal/dto"
+	"sso-server/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func (ac *AdminController) ListPermissions(c *fiber.Ctx) error {
+	var permissions []models.Permission
+	if err := ac.DB.Order("slug").Find(&permissions).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not load permissions"})
+	}
+	resp := make([]fiber.Map, 0, len(permissions))
+	for _, p := range permissions {
+		resp = append(resp, mapPermission(p))
+	}
+	return c.JSON(resp)
+}
+
+func (ac *AdminController) CreatePermission(c *fiber.Ctx) error {
+	var req dto.PermissionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	if errs := validateStruct(req); errs != nil {
+		return c.Status(400).JSON(fiber.Map{"message": "validation error", "errors": errs})
+	}
+	if ac.permissionTaken(req, nil) {
+		return c.Status(409).JSON(fiber.Map{"message": "a permission with this name or slug already exists"})
+	}
+	permission := models.Permission{Name: req.Name, Slug: req.Slug}
+	if err := ac.DB.Create(&permission).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not create permission"})
+	}
+	return c.Status(201).JSON(mapPermission(permission))
+}
+
+// UpdatePermission renames a permission. Changing the slug changes what
+// downstream services see in the permissions claim of new tokens.
+func (ac *AdminController) UpdatePermission(c *fiber.Ctx) error {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	var req dto.PermissionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	if errs := validateStruct(req); errs != nil {
+		return c.Status(400).JSON(fiber.Map{"message": "validation error", "errors": errs})
+	}
+	var permission models.Permission
+	if err := ac.DB.First(&permission, "id = ?", id).Error; err != nil {
+		return notFoundOr500(c, err, "permission")
+	}
+	if ac.permissionTaken(req, &permission) {
+		return c.Status(409).JSON(fiber.Map{"message": "a permission with this name or slug already exists"})
+	}
+	if err := ac.DB.Model(&permission).Updates(models.Permission{Name: req.Name, Slug: req.Slug}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not update permission"})
+	}
+	permission.Name, permission.Slug = req.Name, req.Slug
+	return c.JSON(mapPermission(permission))
+}
+
+// DeletePermission removes a permission from every role and client holding
+// it, then deletes it.
+func (ac *AdminController) DeletePermission(c *fiber.Ctx) error {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	var permission models.Permission
+	if err := ac.DB.First(&permission, "id = ?", id).Error; err != nil {
+		return notFoundOr500(c, err, "permission")
+	}
+	err = ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM role_permissions WHERE permission_id = ?", permission.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM client_permissions WHERE permission_id = ?", permission.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&permission).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not delete permission"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (ac *AdminController) permissionTaken(req dto.PermissionRequest, except *models.Permission) bool {
+	q := ac.DB.Model(&models.Permission{}).Where("name = ? OR slug = ?", req.Name, req.Slug)
+	if except != nil {
+		q = q.Where("id <> ?", except.ID)
+	}
+	var count int64
+	q.Count(&count)
+	return count > 0
+}
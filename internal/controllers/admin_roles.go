@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"sso-server/internal/dto"
+	"sso-server/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func mapRole(role models.Role) fiber.Map {
+	permissions := make([]fiber.Map, 0, len(role.Permissions))
+	for _, p := range role.Permissions {
+		permissions = append(permissions, mapPermission(p))
+	}
+	return fiber.Map{
+		"id":          role.ID,
+		"name":        role.Name,
+		"system":      role.System,
+		"require_mfa": role.RequireMFA,
+		"permissions": permissions,
+		"created_at":  role.CreatedAt,
+		"updated_at":  role.UpdatedAt,
+	}
+}
+
+func mapPermission(p models.Permission) fiber.Map {
+	return fiber.Map{
+		"id":   p.ID,
+		"name": p.Name,
+		"slug": p.Slug,
+	}
+}
+
+func (ac *AdminController) ListRoles(c *fiber.Ctx) error {
+	var roles []models.Role
+	if err := ac.DB.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not load roles"})
+	}
+	resp := make([]fiber.Map, 0, len(roles))
+	for _, role := range roles {
+		resp = append(resp, mapRole(role))
+	}
+	return c.JSON(resp)
+}
+
+func (ac *AdminController) GetRole(c *fiber.Ctx) error {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	var role models.Role
+	if err := ac.DB.Preload("Permissions").First(&role, "id = ?", id).Error; err != nil {
+		return notFoundOr500(c, err, "role")
+	}
+	return c.JSON(mapRole(role))
+}
+
+func (ac *AdminController) CreateRole(c *fiber.Ctx) error {
+	var req dto.RoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	if errs := validateStruct(req); errs != nil {
+		return c.Status(400).JSON(fiber.Map{"message": "validation error", "errors": errs})
+	}
+	if ac.roleNameTaken(req.Name, nil) {
+		return c.Status(409).JSON(fiber.Map{"message": "a role with this name already exists"})
+	}
+	role := models.Role{Name: req.Name}
+	if err := ac.DB.Create(&role).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not create role"})
+	}
+	return c.Status(201).JSON(mapRole(role))
+}
+
+// RenameRole changes a role's name. System roles are looked up by name
+// during registration and seeding, so they keep theirs.
+func (ac *AdminController) RenameRole(c *fiber.Ctx) error {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	var req dto.RoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	if errs := validateStruct(req); errs != nil {
+		return c.Status(400).JSON(fiber.Map{"message": "validation error", "errors": errs})
+	}
+	var role models.Role
+	if err := ac.DB.Preload("Permissions").First(&role, "id = ?", id).Error; err != nil {
+		return notFoundOr500(c, err, "role")
+	}
+	if role.System {
+		return c.Status(409).JSON(fiber.Map{"message": "system roles cannot be renamed"})
+	}
+	if ac.roleNameTaken(req.Name, &role) {
+		return c.Status(409).JSON(fiber.Map{"message": "a role with this name already exists"})
+	}
+	if err := ac.DB.Model(&role).Update("name", req.Name).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not rename role"})
+	}
+	role.Name = req.Name
+	return c.JSON(mapRole(role))
+}
+
+// DeleteRole removes a role that is neither a system role nor assigned to
+// any user, including soft-deleted ones that could be restored.
+func (ac *AdminController) DeleteRole(c *fiber.Ctx) error {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	var role models.Role
+	if err := ac.DB.First(&role, "id = ?", id).Error; err != nil {
+		return notFoundOr500(c, err, "role")
+	}
+	if role.System {
+		return c.Status(409).JSON(fiber.Map{"message": "system roles cannot be deleted"})
+	}
+	var users int64
+	if err := ac.DB.Unscoped().Model(&models.User{}).Where("role_id = ?", role.ID).Count(&users).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not delete role"})
+	}
+	if users > 0 {
+		return c.Status(409).JSON(fiber.Map{"message": "role is still assigned to users"})
+	}
+	err = ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not delete role"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// AttachPermission grants a permission to every user holding the role.
+// Attaching a permission the role already has is a no-op.
+func (ac *AdminController) AttachPermission(c *fiber.Ctx) error {
+	role, permission, err := ac.rolePermission(c)
+	if role == nil {
+		return err
+	}
+	if err := ac.DB.Model(role).Association("Permissions").Append(permission); err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not attach permission"})
+	}
+	return ac.GetRole(c)
+}
+
+func (ac *AdminController) DetachPermission(c *fiber.Ctx) error {
+	role, permission, err := ac.rolePermission(c)
+	if role == nil {
+		return err
+	}
+	if err := ac.DB.Model(role).Association("Permissions").Delete(permission); err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not detach permission"})
+	}
+	return ac.GetRole(c)
+}
+
+// rolePermission loads the role and permission named by the route. When the
+// role is nil the error response has already been written.
+func (ac *AdminController) rolePermission(c *fiber.Ctx) (*models.Role, *models.Permission, error) {
+	roleID, err := paramID(c, "id")
+	if err != nil {
+		return nil, nil, c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	permissionID, err := paramID(c, "permission_id")
+	if err != nil {
+		return nil, nil, c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	var role models.Role
+	if err := ac.DB.First(&role, "id = ?", roleID).Error; err != nil {
+		return nil, nil, notFoundOr500(c, err, "role")
+	}
+	var permission models.Permission
+	if err := ac.DB.First(&permission, "id = ?", permissionID).Error; err != nil {
+		return nil, nil, notFoundOr500(c, err, "permission")
+	}
+	return &role, &permission, nil
+}
+
+func (ac *AdminController) roleNameTaken(name string, except *models.Role) bool {
+	q := ac.DB.Model(&models.Role{}).Where("name = ?", name)
+	if except != nil {
+		q = q.Where("id <> ?", except.ID)
+	}
+	var count int64
+	q.Count(&count)
+	return count > 0
+}
+
+// SetRoleMFA turns the second-factor requirement of a role on or off.
+// Sessions of its users that were opened without a second factor are asked
+// to sign in again on their next visit, and their refresh tokens issued
+// without one are revoked. The Administrator role always requires it.
+func (ac *AdminController) SetRoleMFA(c *fiber.Ctx) error {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	var req dto.RoleMFARequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	if errs := validateStruct(req); errs != nil {
+		return c.Status(400).JSON(fiber.Map{"message": "validation error", "errors": errs})
+	}
+	var role models.Role
+	if err := ac.DB.Preload("Permissions").First(&role, "id = ?", id).Error; err != nil {
+		return notFoundOr500(c, err, "role")
+	}
+	if role.Name == "Administrator" && !*req.Required {
+		return c.Status(409).JSON(fiber.Map{"message": "the Administrator role always requires two-factor authentication"})
+	}
+	if err := ac.DB.Model(&role).Update("require_mfa", *req.Required).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not update role"})
+	}
+	role.RequireMFA = *req.Required
+	if role.RequireMFA {
+		users := ac.DB.Unscoped().Model(&models.User{}).Select("id").Where("role_id = ?", role.ID)
+		if err := ac.Auth.revokeRefreshTokensWithoutMFA(users); err != nil {
+			return c.Status(500).JSON(fiber.Map{"message": "role updated but refresh tokens could not be revoked"})
+		}
+	}
+	return c.JSON(mapRole(role))
+}
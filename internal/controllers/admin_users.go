@@ -0,0 +1,323 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"sso-server/internal/dto"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 100
+)
+
+func mapAdminUser(user models.User, profile *models.UserProfile) fiber.Map {
+	resp := fiber.Map{
+		"id":    user.ID,
+		"email": user.Email,
+		"role": fiber.Map{
+			"id":   user.Role.ID,
+			"name": user.Role.Name,
+		},
+		"email_verified_at":       user.EmailVerifiedAt,
+		"disabled_at":             user.DisabledAt,
+		"password_reset_required": user.PasswordResetRequired,
+		"created_at":              user.CreatedAt,
+		"updated_at":              user.UpdatedAt,
+		"deleted_at":              nil,
+	}
+	if user.DeletedAt.Valid {
+		resp["deleted_at"] = user.DeletedAt.Time
+	}
+	if profile != nil {
+		resp["profile"] = fiber.Map{
+			"full_name":  profile.FullName,
+			"updated_at": profile.UpdatedAt,
+		}
+	}
+	return resp
+}
+
+// userCursor is a position in the user list, ordered newest first.
+type userCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (cur userCursor) encode() string {
+	raw := cur.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + cur.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeUserCursor(s string) (userCursor, error) {
+	var cur userCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cur, errors.New("invalid cursor")
+	}
+	createdAt, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return cur, errors.New("invalid cursor")
+	}
+	if cur.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return cur, errors.New("invalid cursor")
+	}
+	if cur.ID, err = uuid.Parse(id); err != nil {
+		return cur, errors.New("invalid cursor")
+	}
+	return cur, nil
+}
+
+// parseDateParam accepts an RFC 3339 timestamp or a plain date.
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// ListUsers pages through users newest first. Filters: email (substring),
+// role (name), created_after, created_before and deleted (exclude, include
+// or only). Pass next_cursor back as cursor to get the following page.
+func (ac *AdminController) ListUsers(c *fiber.Ctx) error {
+	q := ac.DB.Model(&models.User{}).Preload("Role")
+	switch c.Query("deleted", "exclude") {
+	case "exclude":
+	case "include":
+		q = q.Unscoped()
+	case "only":
+		q = q.Unscoped().Where("users.deleted_at IS NOT NULL")
+	default:
+		return c.Status(400).JSON(fiber.Map{"message": "deleted must be exclude, include or only"})
+	}
+	if email := c.Query("email"); email != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(email)
+		q = q.Where("users.email ILIKE ?", "%"+escaped+"%")
+	}
+	if role := c.Query("role"); role != "" {
+		q = q.Where("users.role_id IN (?)", ac.DB.Model(&models.Role{}).Select("id").Where("name = ?", role))
+	}
+	for _, filter := range [][2]string{{"created_after", ">="}, {"created_before", "<"}} {
+		param, op := filter[0], filter[1]
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := parseDateParam(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"message": param + " must be a date or RFC 3339 timestamp"})
+		}
+		q = q.Where("users.created_at "+op+" ?", t)
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		cur, err := decodeUserCursor(cursor)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+		}
+		q = q.Where("(users.created_at, users.id) < (?, ?)", cur.CreatedAt, cur.ID)
+	}
+	limit := c.QueryInt("limit", defaultUserPageSize)
+	if limit < 1 || limit > maxUserPageSize {
+		limit = defaultUserPageSize
+	}
+
+	var users []models.User
+	if err := q.Order("users.created_at DESC, users.id DESC").Limit(limit + 1).Find(&users).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not load users"})
+	}
+	var nextCursor interface{}
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[limit-1]
+		nextCursor = userCursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode()
+	}
+	data := make([]fiber.Map, 0, len(users))
+	for _, user := range users {
+		data = append(data, mapAdminUser(user, nil))
+	}
+	return c.JSON(fiber.Map{"data": data, "next_cursor": nextCursor})
+}
+
+// GetUser shows a user with profile and role, including soft-deleted users.
+func (ac *AdminController) GetUser(c *fiber.Ctx) error {
+	user, err := ac.findUser(c)
+	if user == nil {
+		return err
+	}
+	var resp fiber.Map
+	var profile models.UserProfile
+	if err := ac.DB.Where("user_id = ?", user.ID).First(&profile).Error; err != nil {
+		resp = mapAdminUser(*user, nil)
+	} else {
+		resp = mapAdminUser(*user, &profile)
+	}
+	resp["mfa_enabled"] = ac.Auth.confirmedTOTP(user.ID) != nil
+	return c.JSON(resp)
+}
+
+func (ac *AdminController) ChangeUserRole(c *fiber.Ctx) error {
+	user, err := ac.findUser(c)
+	if user == nil {
+		return err
+	}
+	var req dto.ChangeRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	if errs := validateStruct(req); errs != nil {
+		return c.Status(400).JSON(fiber.Map{"message": "validation error", "errors": errs})
+	}
+	var role models.Role
+	if err := ac.DB.First(&role, "id = ?", req.RoleID).Error; err != nil {
+		return notFoundOr500(c, err, "role")
+	}
+	if err := ac.DB.Unscoped().Model(user).Update("role_id", role.ID).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not change role"})
+	}
+	user.RoleID, user.Role = role.ID, role
+	if role.RequireMFA {
+		users := ac.DB.Unscoped().Model(&models.User{}).Select("id").Where("id = ?", user.ID)
+		if err := ac.Auth.revokeRefreshTokensWithoutMFA(users); err != nil {
+			return c.Status(500).JSON(fiber.Map{"message": "role changed but refresh tokens could not be revoked"})
+		}
+	}
+	return c.JSON(mapAdminUser(*user, nil))
+}
+
+// DisableUser locks the account and ends all of its sessions.
+func (ac *AdminController) DisableUser(c *fiber.Ctx) error {
+	user, err := ac.findOtherUser(c)
+	if user == nil {
+		return err
+	}
+	if !user.Disabled() {
+		now := time.Now()
+		if err := ac.DB.Unscoped().Model(user).Update("disabled_at", now).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"message": "could not disable user"})
+		}
+		user.DisabledAt = &now
+	}
+	if err := ac.Auth.endUserSessions(c.Context(), user.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "user disabled but sessions could not be ended"})
+	}
+	return c.JSON(mapAdminUser(*user, nil))
+}
+
+func (ac *AdminController) EnableUser(c *fiber.Ctx) error {
+	user, err := ac.findUser(c)
+	if user == nil {
+		return err
+	}
+	if err := ac.DB.Unscoped().Model(user).Update("disabled_at", nil).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not enable user"})
+	}
+	user.DisabledAt = nil
+	return c.JSON(mapAdminUser(*user, nil))
+}
+
+// DeleteUser soft-deletes the user and ends all of its sessions. The row is
+// kept so the account can be restored.
+func (ac *AdminController) DeleteUser(c *fiber.Ctx) error {
+	user, err := ac.findOtherUser(c)
+	if user == nil {
+		return err
+	}
+	if err := ac.DB.Delete(user).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not delete user"})
+	}
+	if err := ac.Auth.endUserSessions(c.Context(), user.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "user deleted but sessions could not be ended"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (ac *AdminController) RestoreUser(c *fiber.Ctx) error {
+	user, err := ac.findUser(c)
+	if user == nil {
+		return err
+	}
+	if err := ac.DB.Unscoped().Model(user).Update("deleted_at", nil).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not restore user"})
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+	return c.JSON(mapAdminUser(*user, nil))
+}
+
+// ForcePasswordReset signs the user out everywhere, blocks sign-in until the
+// password has been reset and emails the user a reset link.
+func (ac *AdminController) ForcePasswordReset(c *fiber.Ctx) error {
+	user, err := ac.findUser(c)
+	if user == nil {
+		return err
+	}
+	if err := ac.DB.Unscoped().Model(user).Update("password_reset_required", true).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not require a password reset"})
+	}
+	user.PasswordResetRequired = true
+	if err := ac.Auth.endUserSessions(c.Context(), user.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "reset required but sessions could not be ended"})
+	}
+	token, err := ac.Auth.issuePasswordResetToken(c.Context(), user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "reset required but the reset link could not be created"})
+	}
+	go ac.Auth.sendPasswordResetMail(user.Email, token)
+	return c.JSON(mapAdminUser(*user, nil))
+}
+
+// findUser loads the user named by the route, soft-deleted or not. When the
+// user is nil the error response has already been written.
+func (ac *AdminController) findUser(c *fiber.Ctx) (*models.User, error) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	var user models.User
+	if err := ac.DB.Unscoped().Preload("Role").First(&user, "id = ?", id).Error; err != nil {
+		return nil, notFoundOr500(c, err, "user")
+	}
+	return &user, nil
+}
+
+// findOtherUser is findUser for actions an administrator may not take on
+// their own account, so they cannot lock themselves out.
+func (ac *AdminController) findOtherUser(c *fiber.Ctx) (*models.User, error) {
+	user, err := ac.findUser(c)
+	if user == nil {
+		return nil, err
+	}
+	if self, err := helper.GetUserFromContext(c); err == nil && self.ID == user.ID {
+		return nil, c.Status(409).JSON(fiber.Map{"message": "you cannot do this to your own account"})
+	}
+	return user, nil
+}
+
+// ResetUserMFA removes a user's authenticator and recovery codes, e.g. after
+// they lost their phone, and signs them out. If their role requires a second
+// factor they enroll again at the next sign-in.
+func (ac *AdminController) ResetUserMFA(c *fiber.Ctx) error {
+	user, err := ac.findOtherUser(c)
+	if user == nil {
+		return err
+	}
+	if err := ac.Auth.resetMFA(user.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not reset two-factor authentication"})
+	}
+	if err := ac.Auth.endUserSessions(c.Context(), user.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "two-factor reset but sessions could not be ended"})
+	}
+	go ac.Auth.sendMail(user.Email, "Two-factor authentication reset",
+		"An administrator removed the authenticator app from your account. "+
+			"If your account requires two-factor authentication you will be asked to set it up again at your next sign-in.")
+	resp := mapAdminUser(*user, nil)
+	resp["mfa_enabled"] = false
+	return c.JSON(resp)
+}
@@ -1,11 +1,15 @@
 package controllers
 
 import (
-	"crypto/rsa"
+	"errors"
+	"net/url"
 	"os"
+	"regexp"
 	"sso-server/internal/dto"
 	"sso-server/internal/helper"
+	"sso-server/internal/mail"
 	"sso-server/internal/models"
+	"strings"
 	"time"
 	"unicode"
 
@@ -43,21 +47,43 @@ func isStrongPassword(fl validator.FieldLevel) bool {
 	return hasUpper && hasLower && hasNumber && hasSpecial
 }
 
+// permissionSlugPattern is "<service>:<action>", the service part being what
+// client audiences and resource scopes refer to.
+var permissionSlugPattern = regexp.MustCompile(`^[a-z0-9_-]+:[a-z0-9_-]+$`)
+
+func isPermissionSlug(fl validator.FieldLevel) bool {
+	return permissionSlugPattern.MatchString(fl.Field().String())
+}
+
 var validate *validator.Validate
 
 func init() {
 	validate = validator.New()
 	validate.RegisterValidation("strong_password", isStrongPassword)
+	validate.RegisterValidation("permission_slug", isPermissionSlug)
 }
 
 type AuthController struct {
-	DB         *gorm.DB
-	PrivateKey *rsa.PrivateKey
-	Redis      *redis.Client
+	DB       *gorm.DB
+	Keys     *helper.KeySet
+	Redis    *redis.Client
+	Denylist *helper.TokenDenylist
+	Mailer   mail.Mailer
+	// ForbidPlainPKCE rejects code_challenge_method=plain so only S256 is accepted.
+	ForbidPlainPKCE bool
 }
 
 func validateStruct(req interface{}) map[string]string {
-	err := validate.Struct(req)
+	return validationErrors(validate.Struct(req))
+}
+
+// validateStructExcept is validateStruct without the rules of the named
+// fields.
+func validateStructExcept(req interface{}, fields ...string) map[string]string {
+	return validationErrors(validate.StructExcept(req, fields...))
+}
+
+func validationErrors(err error) map[string]string {
 	if err == nil {
 		return nil
 	}
@@ -113,7 +139,7 @@ func (ac *AuthController) createUser(c *fiber.Ctx, roleName string) (*models.Use
 }
 
 func (ac *AuthController) ReaderRegister(c *fiber.Ctx) error {
-	_, valErrors, err := ac.createUser(c, "Blog:Reader")
+	user, valErrors, err := ac.createUser(c, "Blog:Reader")
 	if valErrors != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"message": "validation error",
@@ -123,6 +149,7 @@ func (ac *AuthController) ReaderRegister(c *fiber.Ctx) error {
 	if err != nil {
 		return nil
 	}
+	go ac.sendVerificationMail(*user)
 	return c.Redirect("/login")
 }
 
@@ -137,6 +164,7 @@ func (ac *AuthController) EditorRegister(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"message": err.Error()})
 	}
+	go ac.sendVerificationMail(*user)
 	return c.Status(201).JSON(ac.mapUser(*user))
 }
 func (ac *AuthController) mapUser(user models.User) fiber.Map {
@@ -148,49 +176,145 @@ func (ac *AuthController) mapUser(user models.User) fiber.Map {
 		"role":  role.Name,
 	}
 }
+
+var (
+	errAccountDisabled       = errors.New("this account has been disabled")
+	errPasswordResetRequired = errors.New("your password must be reset before you can sign in")
+)
+
+// loginErrorMessage is the message shown on the login form for an
+// authenticateUser error.
+func loginErrorMessage(err error) string {
+	if errors.Is(err, errAccountDisabled) || errors.Is(err, errPasswordResetRequired) {
+		msg := err.Error()
+		return strings.ToUpper(msg[:1]) + msg[1:]
+	}
+	return "Incorrect email or password"
+}
+
+func (ac *AuthController) authenticateUser(email, password string) (*models.User, error) {
+	var user models.User
+	if err := ac.DB.Preload("Role").Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !helper.ComparePassword(user.PasswordHash, password) {
+		return nil, errors.New("incorrect password")
+	}
+	// Account state is only revealed once the password has been checked.
+	if user.Disabled() {
+		return nil, errAccountDisabled
+	}
+	if user.PasswordResetRequired {
+		return nil, errPasswordResetRequired
+	}
+	return &user, nil
+}
+
 func (ac *AuthController) Login(c *fiber.Ctx) error {
 	var req dto.LoginRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
 	}
 
-	redirectURL := c.Query("redirect_url")
-	var user models.User
-	res := ac.DB.Preload("Role").Where("email = ?", req.Email).First(&user)
+	client, err := ac.findClient(c.Query("client_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": "unknown client"})
+	}
+	if !client.AllowsRedirectURI(c.Query("redirect_url")) {
+		return c.Status(400).JSON(fiber.Map{"message": "redirect_url is not registered for this client"})
+	}
+	// The legacy flow has no consent screen, so only first-party clients may
+	// use it; everyone else goes through /authorize.
+	if !client.FirstParty {
+		return c.Status(400).JSON(fiber.Map{"message": "this client must use /authorize"})
+	}
+	user, err := ac.authenticateUser(req.Email, req.Password)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	if ac.mfaRequired(user) {
+		return ac.startSecondFactor(c, user, req.Remember != "", os.Getenv("APP_URL")+"/login?"+string(c.Request().URI().QueryString()))
+	}
+	session, err := ac.createSession(c, user, req.Remember != "", false)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "failed to store session"})
+	}
+	return ac.redirectWithCode(c, client, user, session)
+}
 
-	if res.Error != nil {
-		return c.Status(400).JSON(fiber.Map{"message": "user not found"})
+// redirectWithCode finishes the legacy /login flow by sending an auth code
+// to the client's redirect_url.
+func (ac *AuthController) redirectWithCode(c *fiber.Ctx, client *models.Client, user *models.User, session *ssoSession) error {
+	if emailVerificationRequired(client, user) {
+		return c.Status(403).JSON(fiber.Map{"message": "email address is not verified"})
+	}
+	redirectURL := c.Query("redirect_url")
+	challengeMethod, err := ac.checkPKCE(client, c.Query("code_challenge"), c.Query("code_challenge_method"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
 	}
-	if !helper.ComparePassword(user.PasswordHash, req.Password) {
-		return c.Status(400).JSON(fiber.Map{"message": "incorrect password"})
+	authCode, err := ac.issueAuthCode(c.Context(), authCode{
+		UserID:      user.ID.String(),
+		ClientID:    client.ClientID,
+		RedirectURI: redirectURL,
+		AuthTime:    session.AuthTime,
+		SessionID:   session.SID,
+		MFA:         session.MFA,
+
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: challengeMethod,
+	})
+	if err == nil {
+		err = ac.trackSessionClient(c.Context(), session, client.ClientID)
 	}
-	authCode := uuid.New().String()
-	err := ac.Redis.Set(c.Context(), "auth_code:"+authCode, user.ID.String(), 5*time.Minute).Err()
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"message": "failed to store session"})
 	}
 
-	// 3. Redirect back to Next.js Callback with the CODE
-	return c.Redirect(redirectURL + "?code=" + authCode)
+	// 3. Redirect back to the client callback with the CODE
+	return c.Redirect(appendQuery(redirectURL, url.Values{"code": {authCode}}))
 }
 func (ac *AuthController) ExchangeCode(c *fiber.Ctx) error {
 	var req struct {
-		Code string `json:"code"`
+		Code         string `json:"code"`
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		CodeVerifier string `json:"code_verifier"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid request"})
 	}
-	userID, err := ac.Redis.Get(c.Context(), "auth_code:"+req.Code).Result()
+	client, err := ac.authenticateClient(c, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid client"})
+	}
+	code, err := ac.consumeAuthCode(c.Context(), req.Code)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "code expired or invalid"})
 	}
-	ac.Redis.Del(c.Context(), "auth_code:"+req.Code)
+	if code.ClientID != client.ClientID {
+		return c.Status(400).JSON(fiber.Map{"error": "code was not issued to this client"})
+	}
+	if err := verifyPKCE(client, code, req.CodeVerifier); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 	var user models.User
-	if err := ac.DB.Preload("Role").First(&user, "id = ?", userID).Error; err != nil {
+	if err := ac.DB.Preload("Role.Permissions").First(&user, "id = ?", code.UserID).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "user not found"})
 	}
+	if user.Disabled() {
+		return c.Status(400).JSON(fiber.Map{"error": "user account is disabled"})
+	}
+	if !code.MFA && ac.mfaRequired(&user) {
+		return c.Status(400).JSON(fiber.Map{"error": "a second factor is required"})
+	}
 
-	token, err := helper.GenerateToken(user, ac.PrivateKey)
+	// Legacy requests carry no scope, so the token gets every permission for
+	// the audiences the client is registered for.
+	grant := accessTokenGrant(user, client, "", strings.Join(client.Audiences, " "))
+	grant.AuthTime = time.Unix(code.AuthTime, 0)
+	grant.SessionID = code.SessionID
+	token, err := helper.GenerateToken(user, grant, ac.Keys)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "token generation failed"})
 	}
@@ -208,8 +332,37 @@ func (ac *AuthController) ShowRegister(c *fiber.Ctx) error {
 }
 
 func (ac *AuthController) ShowLogin(c *fiber.Ctx) error {
+	client, err := ac.findClient(c.Query("client_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": "unknown client"})
+	}
+	if !client.AllowsRedirectURI(c.Query("redirect_url")) {
+		return c.Status(400).JSON(fiber.Map{"message": "redirect_url is not registered for this client"})
+	}
+	// The legacy flow has no consent screen, so only first-party clients may
+	// use it; everyone else goes through /authorize.
+	if !client.FirstParty {
+		return c.Status(400).JSON(fiber.Map{"message": "this client must use /authorize"})
+	}
+	if session, user := ac.currentSession(c); session != nil && ac.sessionSatisfiesMFA(session, user) {
+		return ac.redirectWithCode(c, client, user, session)
+	}
 	return c.Render("login", fiber.Map{
-		"RedirectURL": c.Query("redirect_url"),
-		"AppUrl":      os.Getenv("APP_URL"),
+		"FormAction": os.Getenv("APP_URL") + "/login?" + string(c.Request().URI().QueryString()),
+		"AppUrl":     os.Getenv("APP_URL"),
 	})
 }
+
+// appendQuery adds params to rawURL, preserving any query it already carries.
+func appendQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const authCodeTTL = 5 * time.Minute
+
+var errInvalidCode = errors.New("code expired or invalid")
+
+// authCode is the payload stored in Redis under "auth_code:<code>" between
+// the login redirect and the code exchange.
+type authCode struct {
+	UserID      string `json:"user_id"`
+	ClientID    string `json:"client_id"`
+	RedirectURI string `json:"redirect_uri"`
+	Scope       string `json:"scope,omitempty"`
+	Nonce       string `json:"nonce,omitempty"`
+	AuthTime    int64  `json:"auth_time"`
+	SessionID   string `json:"sid,omitempty"`
+	MFA         bool   `json:"mfa,omitempty"`
+
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+}
+
+func (ac *AuthController) issueAuthCode(ctx context.Context, payload authCode) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	code := uuid.New().String()
+	if err := ac.Redis.Set(ctx, "auth_code:"+code, data, authCodeTTL).Err(); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// consumeAuthCode atomically reads and deletes the code so it can only be
+// redeemed once.
+func (ac *AuthController) consumeAuthCode(ctx context.Context, code string) (*authCode, error) {
+	if code == "" {
+		return nil, errInvalidCode
+	}
+	data, err := ac.Redis.GetDel(ctx, "auth_code:"+code).Bytes()
+	if err != nil {
+		return nil, errInvalidCode
+	}
+	var payload authCode
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, errInvalidCode
+	}
+	return &payload, nil
+}
+
+// checkPKCE validates the code_challenge sent with an authorization request
+// and returns the effective challenge method. PKCE is mandatory for public
+// clients since they cannot authenticate at the token endpoint.
+func (ac *AuthController) checkPKCE(client *models.Client, challenge, method string) (string, error) {
+	if challenge == "" {
+		if client.Public {
+			return "", errors.New("code_challenge is required for public clients")
+		}
+		if method != "" {
+			return "", errors.New("code_challenge_method sent without code_challenge")
+		}
+		return "", nil
+	}
+	return helper.NormalizeCodeChallengeMethod(challenge, method, !ac.ForbidPlainPKCE)
+}
+
+// verifyPKCE checks the code_verifier presented at the token endpoint against
+// the challenge stored with the code.
+func verifyPKCE(client *models.Client, code *authCode, verifier string) error {
+	if code.CodeChallenge == "" {
+		if client.Public {
+			return errors.New("code was issued without a code_challenge")
+		}
+		if verifier != "" {
+			return errors.New("code_verifier sent but no code_challenge was registered")
+		}
+		return nil
+	}
+	if verifier == "" {
+		return errors.New("code_verifier is required")
+	}
+	if !helper.VerifyCodeVerifier(verifier, code.CodeChallenge, code.CodeChallengeMethod) {
+		return errors.New("code_verifier does not match code_challenge")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"strings"
+	"time"
+)
+
+const backchannelAttempts = 3
+
+var backchannelClient = &http.Client{Timeout: 5 * time.Second}
+
+// notifyBackchannelLogout sends a logout token to every client in clientIDs
+// that registered a backchannel_logout_uri. Deliveries run in the background
+// with retries; each one is recorded as a models.LogoutDelivery.
+func (ac *AuthController) notifyBackchannelLogout(clientIDs []string, userID, sid string) {
+	if len(clientIDs) == 0 {
+		return
+	}
+	var clients []models.Client
+	if err := ac.DB.Where("client_id IN ? AND backchannel_logout_uri <> ''", clientIDs).Find(&clients).Error; err != nil {
+		log.Printf("backchannel logout: could not load clients: %v", err)
+		return
+	}
+	for _, client := range clients {
+		delivery := models.LogoutDelivery{
+			ClientID:  client.ClientID,
+			UserID:    userID,
+			SessionID: sid,
+			URI:       client.BackchannelLogoutURI,
+			Status:    models.LogoutDeliveryPending,
+		}
+		if err := ac.DB.Create(&delivery).Error; err != nil {
+			log.Printf("backchannel logout: could not record delivery to %s: %v", client.ClientID, err)
+			continue
+		}
+		go ac.deliverBackchannelLogout(delivery)
+	}
+}
+
+// deliverBackchannelLogout POSTs a fresh logout token until the client
+// answers 2xx or the attempts run out, backing off between tries.
+func (ac *AuthController) deliverBackchannelLogout(delivery models.LogoutDelivery) {
+	backoff := time.Second
+	for attempt := 1; attempt <= backchannelAttempts; attempt++ {
+		statusCode, err := ac.postLogoutToken(delivery)
+		delivery.Attempts = attempt
+		delivery.StatusCode = statusCode
+		if err == nil {
+			now := time.Now()
+			delivery.Status = models.LogoutDeliveryDelivered
+			delivery.DeliveredAt = &now
+			delivery.LastError = ""
+			ac.DB.Save(&delivery)
+			return
+		}
+		delivery.LastError = err.Error()
+		if attempt == backchannelAttempts {
+			delivery.Status = models.LogoutDeliveryFailed
+			log.Printf("backchannel logout to %s failed after %d attempts: %v", delivery.ClientID, attempt, err)
+		}
+		ac.DB.Save(&delivery)
+		if attempt < backchannelAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+func (ac *AuthController) postLogoutToken(delivery models.LogoutDelivery) (int, error) {
+	token, err := helper.GenerateLogoutToken(delivery.ClientID, delivery.UserID, delivery.SessionID, ac.Keys)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := backchannelClient.Post(delivery.URI, "application/x-www-form-urlencoded",
+		strings.NewReader(url.Values{"logout_token": {token}}.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
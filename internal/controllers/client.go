@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var errInvalidClient = errors.New("invalid client")
+
+func (ac *AuthController) findClient(clientID string) (*models.Client, error) {
+	if clientID == "" {
+		return nil, errInvalidClient
+	}
+	var client models.Client
+	if err := ac.DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		return nil, errInvalidClient
+	}
+	return &client, nil
+}
+
+// authenticateClient resolves the calling client from HTTP Basic credentials,
+// falling back to the client_id/client_secret sent in the request body.
+// Public clients only need to identify themselves; confidential clients must
+// present a secret matching the stored hash.
+func (ac *AuthController) authenticateClient(c *fiber.Ctx, clientID, clientSecret string) (*models.Client, error) {
+	if id, secret, ok := basicAuth(c); ok {
+		clientID, clientSecret = id, secret
+	}
+	client, err := ac.findClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		return client, nil
+	}
+	if clientSecret == "" || !helper.ComparePassword(client.SecretHash, clientSecret) {
+		return nil, errInvalidClient
+	}
+	return client, nil
+}
+
+// basicAuth decodes client credentials from an "Authorization: Basic" header.
+// Per RFC 6749 section 2.3.1 both parts are form-urlencoded before encoding.
+func basicAuth(c *fiber.Ctx) (string, string, bool) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(header, "Basic ") {
+		return "", "", false
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+	id, secret, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return "", "", false
+	}
+	id, errID := url.QueryUnescape(id)
+	secret, errSecret := url.QueryUnescape(secret)
+	if errID != nil || errSecret != nil {
+		return "", "", false
+	}
+	return id, secret, true
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"sso-server/internal/dto"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const consentTokenTTL = 10 * time.Minute
+
+var scopeDescriptions = map[string]string{
+	"openid":  "Sign you in with your account",
+	"profile": "See your name, avatar and language and time zone preferences",
+	"email":   "See your email address",
+	"phone":   "See your phone number",
+}
+
+// consentTicket ties a rendered consent form to the session and request it
+// was shown for, so the form cannot be replayed or forged.
+type consentTicket struct {
+	SID      string `json:"sid"`
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+}
+
+// needsConsent reports whether the consent screen must be shown before a
+// code is issued. First-party clients and scopes the user already approved
+// skip it unless the client asked for prompt=consent.
+func (ac *AuthController) needsConsent(user *models.User, client *models.Client, req *dto.AuthorizeRequest) bool {
+	if slices.Contains(strings.Fields(req.Prompt), "consent") {
+		return true
+	}
+	if client.FirstParty {
+		return false
+	}
+	var grant models.Grant
+	if err := ac.DB.Where("user_id = ? AND client_id = ?", user.ID, client.ClientID).First(&grant).Error; err != nil {
+		return true
+	}
+	return !grant.Covers(strings.Fields(req.Scope))
+}
+
+func (ac *AuthController) renderConsent(c *fiber.Ctx, req *dto.AuthorizeRequest, client *models.Client, session *ssoSession) error {
+	token, err := helper.GenerateOpaqueToken()
+	if err != nil {
+		return (&oauthError{Code: "server_error", Description: "failed to render consent"}).redirect(c, req.RedirectURI, req.State)
+	}
+	data, _ := json.Marshal(consentTicket{SID: session.SID, ClientID: client.ClientID, Scope: req.Scope})
+	if err := ac.Redis.Set(c.Context(), "consent:"+helper.HashToken(token), data, consentTokenTTL).Err(); err != nil {
+		return (&oauthError{Code: "server_error", Description: "failed to render consent"}).redirect(c, req.RedirectURI, req.State)
+	}
+
+	type scopeItem struct {
+		Name        string
+		Description string
+	}
+	var scopes []scopeItem
+	for _, s := range strings.Fields(req.Scope) {
+		description, ok := scopeDescriptions[s]
+		if !ok {
+			description = s
+		}
+		scopes = append(scopes, scopeItem{Name: s, Description: description})
+	}
+	return c.Render("consent", fiber.Map{
+		"FormAction":   os.Getenv("APP_URL") + "/authorize/consent?" + string(c.Request().URI().QueryString()),
+		"AppUrl":       os.Getenv("APP_URL"),
+		"ClientName":   client.Name,
+		"Scopes":       scopes,
+		"ConsentToken": token,
+	})
+}
+
+// Consent handles the consent form. Approving stores the grant and issues
+// the code; denying sends access_denied back to the client.
+func (ac *AuthController) Consent(c *fiber.Ctx) error {
+	req, client, oerr := ac.parseAuthorizeRequest(c)
+	if oerr != nil {
+		return oerr.JSON(c)
+	}
+	if oerr := ac.checkAuthorizeRequest(req, client); oerr != nil {
+		return oerr.redirect(c, req.RedirectURI, req.State)
+	}
+	session, user := ac.currentSession(c)
+	if session == nil || !ac.sessionSatisfiesMFA(session, user) {
+		return ac.renderAuthorizeLogin(c, "Your session expired, please sign in again")
+	}
+
+	var form struct {
+		ConsentToken string `form:"consent_token"`
+		Decision     string `form:"decision"`
+	}
+	if err := c.BodyParser(&form); err != nil {
+		return (&oauthError{Code: "invalid_request", Description: "malformed consent form"}).redirect(c, req.RedirectURI, req.State)
+	}
+	data, err := ac.Redis.GetDel(c.Context(), "consent:"+helper.HashToken(form.ConsentToken)).Bytes()
+	var ticket consentTicket
+	if err == nil {
+		err = json.Unmarshal(data, &ticket)
+	}
+	if err != nil || ticket.SID != session.SID || ticket.ClientID != client.ClientID || ticket.Scope != req.Scope {
+		return (&oauthError{Code: "invalid_request", Description: "consent form expired or was tampered with"}).redirect(c, req.RedirectURI, req.State)
+	}
+
+	if form.Decision != "approve" {
+		return (&oauthError{Code: "access_denied", Description: "the user denied the request"}).redirect(c, req.RedirectURI, req.State)
+	}
+	if err := ac.saveGrant(user.ID, client.ClientID, strings.Fields(req.Scope)); err != nil {
+		return (&oauthError{Code: "server_error", Description: "failed to store consent"}).redirect(c, req.RedirectURI, req.State)
+	}
+	return ac.completeAuthorization(c, req, client, user, session)
+}
+
+// saveGrant adds scopes to the user's grant for clientID, creating it on
+// first approval.
+func (ac *AuthController) saveGrant(userID uuid.UUID, clientID string, scopes []string) error {
+	return ac.DB.Transaction(func(tx *gorm.DB) error {
+		var grant models.Grant
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND client_id = ?", userID, clientID).First(&grant).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			grant = models.Grant{ID: uuid.New(), UserID: userID, ClientID: clientID}
+		} else if err != nil {
+			return err
+		}
+		for _, s := range scopes {
+			if !slices.Contains(grant.Scopes, s) {
+				grant.Scopes = append(grant.Scopes, s)
+			}
+		}
+		return tx.Save(&grant).Error
+	})
+}
+
+// ListGrants returns the clients the authenticated user has approved.
+func (ac *AuthController) ListGrants(c *fiber.Ctx) error {
+	user, err := helper.GetUserFromContext(c)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"message": err.Error()})
+	}
+	var grants []models.Grant
+	if err := ac.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&grants).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not load grants"})
+	}
+	resp := make([]fiber.Map, 0, len(grants))
+	for _, grant := range grants {
+		resp = append(resp, fiber.Map{
+			"client_id":  grant.ClientID,
+			"scopes":     grant.Scopes,
+			"created_at": grant.CreatedAt,
+			"updated_at": grant.UpdatedAt,
+		})
+	}
+	return c.JSON(resp)
+}
+
+// RevokeGrant withdraws the user's consent for a client and revokes every
+// refresh token the client holds for the user.
+func (ac *AuthController) RevokeGrant(c *fiber.Ctx) error {
+	user, err := helper.GetUserFromContext(c)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"message": err.Error()})
+	}
+	clientID := c.Params("client_id")
+	err = ac.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("user_id = ? AND client_id = ?", user.ID, clientID).Delete(&models.Grant{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND client_id = ? AND revoked_at IS NULL", user.ID, clientID).
+			Update("revoked_at", time.Now()).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(404).JSON(fiber.Map{"message": "grant not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not revoke grant"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
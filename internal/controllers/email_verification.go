@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"sso-server/internal/dto"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// verificationThrottle limits verification emails to one per address per
+// minute.
+func verificationThrottle(email string) string {
+	return "email_verification_throttle:" + helper.HashToken(strings.ToLower(email))
+}
+
+const verificationSent = "If that address belongs to an unverified account, we have sent it a new verification link."
+
+// sendVerificationMail emails user a signed link that confirms their address.
+func (ac *AuthController) sendVerificationMail(user models.User) {
+	token, err := helper.GenerateEmailVerificationToken(user, ac.Keys)
+	if err != nil {
+		log.Printf("signing email verification token: %v", err)
+		return
+	}
+	link := os.Getenv("APP_URL") + "/verify-email?" + url.Values{"token": {token}}.Encode()
+	ac.sendMail(user.Email, "Verify your email address",
+		"Please confirm that this is your email address by opening this link:\n"+link+"\n\n"+
+			"The link expires in "+helper.EmailVerificationTTL.String()+". "+
+			"If you did not create an account, you can ignore this email.")
+}
+
+// VerifyEmail marks the address in a verification link as verified. Links
+// issued for an address the user has since changed are rejected.
+func (ac *AuthController) VerifyEmail(c *fiber.Ctx) error {
+	invalid := func() error {
+		return c.Status(400).Render("verify_email", fiber.Map{
+			"AppUrl": os.Getenv("APP_URL"),
+			"Error":  "This verification link is invalid or has expired. You can request a new one below.",
+		})
+	}
+	userID, email, err := helper.VerifyEmailVerificationToken(c.Query("token"), ac.Keys)
+	if err != nil {
+		return invalid()
+	}
+	var user models.User
+	if err := ac.DB.First(&user, "id = ?", userID).Error; err != nil || user.Email != email {
+		return invalid()
+	}
+	if !user.EmailVerified() {
+		if err := ac.DB.Model(&user).Update("email_verified_at", time.Now()).Error; err != nil {
+			return c.Status(500).Render("verify_email", fiber.Map{
+				"AppUrl": os.Getenv("APP_URL"),
+				"Error":  "Your email address could not be verified. Please try again.",
+			})
+		}
+	}
+	return c.Render("verify_email", fiber.Map{
+		"AppUrl":   os.Getenv("APP_URL"),
+		"Message":  "Your email address has been verified.",
+		"Verified": true,
+	})
+}
+
+// ResendVerification sends a fresh verification link. Like ForgotPassword
+// it answers the same way for unknown addresses.
+func (ac *AuthController) ResendVerification(c *fiber.Ctx) error {
+	var req dto.ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil || validateStruct(req) != nil {
+		return c.Status(400).Render("verify_email", fiber.Map{
+			"AppUrl": os.Getenv("APP_URL"),
+			"Error":  "Please enter a valid email address",
+		})
+	}
+	sent := func() error {
+		return c.Render("verify_email", fiber.Map{
+			"AppUrl":  os.Getenv("APP_URL"),
+			"Message": verificationSent,
+		})
+	}
+	fresh, err := ac.Redis.SetNX(c.Context(), verificationThrottle(req.Email), 1, time.Minute).Result()
+	if err != nil || !fresh {
+		return sent()
+	}
+	var user models.User
+	if err := ac.DB.Where("email = ?", req.Email).First(&user).Error; err != nil || user.EmailVerified() {
+		return sent()
+	}
+	go ac.sendVerificationMail(user)
+	return sent()
+}
+
+// emailVerificationRequired reports whether client refuses user until the
+// user's email address is verified.
+func emailVerificationRequired(client *models.Client, user *models.User) bool {
+	return client.RequireVerifiedEmail && !user.EmailVerified()
+}
+
+func (ac *AuthController) renderVerifyEmailRequired(c *fiber.Ctx, client *models.Client, user *models.User) error {
+	return c.Status(fiber.StatusForbidden).Render("verify_email", fiber.Map{
+		"AppUrl": os.Getenv("APP_URL"),
+		"Error":  client.Name + " requires a verified email address. Follow the link we sent to " + user.Email + ", or request a new one below.",
+		"Email":  user.Email,
+	})
+}
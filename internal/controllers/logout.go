@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"net/url"
+	"os"
+	"sso-server/internal/dto"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EndSession is the OIDC RP-initiated logout endpoint. It ends the browser's
+// SSO session, revokes the refresh tokens issued under it and sends the user
+// back to a registered post-logout redirect URI. Without an id_token_hint for
+// the signed-in user the request could come from any site, so the user is
+// asked to confirm first.
+func (ac *AuthController) EndSession(c *fiber.Ctx) error {
+	var req dto.LogoutRequest
+	parse := c.QueryParser
+	if c.Method() == fiber.MethodPost {
+		parse = c.BodyParser
+	}
+	if err := parse(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid_request"})
+	}
+
+	clientID := req.ClientID
+	var hintSID, hintSub string
+	if req.IDTokenHint != "" {
+		claims, ok := ac.parseIDTokenHint(req.IDTokenHint)
+		if !ok {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid_request", "error_description": "invalid id_token_hint"})
+		}
+		aud, _ := claims.GetAudience()
+		if len(aud) != 1 || (clientID != "" && clientID != aud[0]) {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid_request", "error_description": "id_token_hint was not issued to client_id"})
+		}
+		clientID = aud[0]
+		hintSID, _ = claims["sid"].(string)
+		hintSub, _ = claims.GetSubject()
+	}
+
+	var client *models.Client
+	if clientID != "" {
+		found, err := ac.findClient(clientID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid_request", "error_description": "unknown client_id"})
+		}
+		client = found
+	}
+	if req.PostLogoutRedirectURI != "" && (client == nil || !client.AllowsPostLogoutRedirectURI(req.PostLogoutRedirectURI)) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid_request", "error_description": "post_logout_redirect_uri is not registered for this client"})
+	}
+
+	// The cookie identifies the browser's own session. The hint's sid is only
+	// used when the cookie is missing, e.g. because it already expired.
+	sid := hintSID
+	if session, _ := ac.currentSession(c); session != nil {
+		sid = session.SID
+		confirmed := c.Method() == fiber.MethodPost && req.ConfirmToken == logoutConfirmToken(c)
+		// A hint for another user says nothing about this browser's session.
+		trusted := req.IDTokenHint != "" && hintSub == session.UserID
+		if !trusted && !confirmed {
+			return c.Render("logout_confirm", fiber.Map{
+				"AppUrl":                os.Getenv("APP_URL"),
+				"ConfirmToken":          logoutConfirmToken(c),
+				"ClientID":              clientID,
+				"PostLogoutRedirectURI": req.PostLogoutRedirectURI,
+				"State":                 req.State,
+			})
+		}
+	}
+	var frontchannelURIs []string
+	if sid != "" {
+		clientIDs, err := ac.sessionClients(c.Context(), sid)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "server_error"})
+		}
+		frontchannelURIs = ac.frontchannelLogoutURIs(clientIDs, sid)
+		if err := ac.endSession(c.Context(), sid); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "server_error"})
+		}
+	}
+	clearSessionCookie(c)
+
+	var redirectURL string
+	if req.PostLogoutRedirectURI != "" {
+		params := url.Values{}
+		if req.State != "" {
+			params.Set("state", req.State)
+		}
+		redirectURL = appendQuery(req.PostLogoutRedirectURI, params)
+	}
+	if redirectURL != "" && len(frontchannelURIs) == 0 {
+		return c.Redirect(redirectURL)
+	}
+	return c.Render("logout", fiber.Map{
+		"AppUrl":           os.Getenv("APP_URL"),
+		"FrontchannelURIs": frontchannelURIs,
+		"RedirectURL":      redirectURL,
+	})
+}
+
+// logoutConfirmToken is derived from the session cookie like
+// accountCSRFToken, so another site cannot post the confirmation form.
+func logoutConfirmToken(c *fiber.Ctx) string {
+	return helper.HashToken("logout:" + c.Cookies(ssoSessionCookie))
+}
+
+// frontchannelLogoutURIs builds the iframe URLs for the clients in the
+// session that registered a frontchannel_logout_uri.
+func (ac *AuthController) frontchannelLogoutURIs(clientIDs []string, sid string) []string {
+	if len(clientIDs) == 0 {
+		return nil
+	}
+	var clients []models.Client
+	if err := ac.DB.Where("client_id IN ? AND frontchannel_logout_uri <> ''", clientIDs).Find(&clients).Error; err != nil {
+		return nil
+	}
+	uris := make([]string, 0, len(clients))
+	for _, client := range clients {
+		uris = append(uris, appendQuery(client.FrontchannelLogoutURI, url.Values{
+			"iss": {helper.Issuer()},
+			"sid": {sid},
+		}))
+	}
+	return uris
+}
+
+// parseIDTokenHint verifies an ID token we issued. Expired tokens are
+// accepted since a hint is often presented long after the token was issued.
+func (ac *AuthController) parseIDTokenHint(hint string) (jwt.MapClaims, bool) {
+	token, err := helper.VerifyIDToken(hint, ac.Keys, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, false
+	}
+	if iss, _ := claims.GetIssuer(); iss != helper.Issuer() {
+		return nil, false
+	}
+	return claims, true
+}
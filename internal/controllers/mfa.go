@@ -0,0 +1,527 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/url"
+	"os"
+	"slices"
+	"sso-server/internal/dto"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaPendingCookie = "mfa_pending"
+	mfaPendingTTL    = 10 * time.Minute
+	maxMFAAttempts   = 5
+	// maxMFAFailures wrong codes within mfaLockout lock the user's second
+	// factor, however many logins they were spread over.
+	maxMFAFailures = 10
+	mfaLockout     = 15 * time.Minute
+	recoveryCodeN  = 10
+)
+
+var errInvalidSecondFactor = errors.New("invalid code")
+
+// mfaPending is a login that passed the password check and waits for the
+// second factor. It is stored in Redis under the hash of the mfa_pending
+// cookie.
+type mfaPending struct {
+	UserID   string `json:"user_id"`
+	Remember bool   `json:"remember"`
+	// Resume is where the browser continues once the session exists.
+	Resume   string `json:"resume"`
+	Attempts int    `json:"attempts"`
+	// EnrollSecret is set when the user's role requires a second factor the
+	// user has not set up yet; the login doubles as enrollment.
+	EnrollSecret string `json:"enroll_secret,omitempty"`
+}
+
+func mfaPendingKey(token string) string {
+	return "mfa_pending:" + helper.HashToken(token)
+}
+
+// mfaFailuresKey counts wrong second-factor codes per user. The per-login
+// attempt count alone would reset every time the password is entered again.
+func mfaFailuresKey(userID uuid.UUID) string {
+	return "mfa_failures:" + userID.String()
+}
+
+func (ac *AuthController) mfaLocked(c *fiber.Ctx, userID uuid.UUID) bool {
+	failures, _ := ac.Redis.Get(c.Context(), mfaFailuresKey(userID)).Int()
+	return failures >= maxMFAFailures
+}
+
+// recordMFAFailure counts a wrong code and tells the user when it locks
+// their second factor, since it means someone else knows the password.
+func (ac *AuthController) recordMFAFailure(c *fiber.Ctx, user *models.User) {
+	key := mfaFailuresKey(user.ID)
+	pipe := ac.Redis.TxPipeline()
+	incr := pipe.Incr(c.Context(), key)
+	pipe.Expire(c.Context(), key, mfaLockout)
+	if _, err := pipe.Exec(c.Context()); err != nil {
+		return
+	}
+	if incr.Val() == maxMFAFailures {
+		go ac.sendMail(user.Email, "Too many incorrect sign-in codes",
+			"Someone entered your password correctly but failed the two-factor check too often, so sign-in is blocked for "+mfaLockout.String()+".\n\n"+
+				"If this was not you, reset your password immediately at "+os.Getenv("APP_URL")+"/forgot-password.")
+	}
+}
+
+func (ac *AuthController) renderMFALocked(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusTooManyRequests).Render("mfa", fiber.Map{
+		"AppUrl":  os.Getenv("APP_URL"),
+		"Error":   "Too many incorrect codes. Please try again in " + mfaLockout.String() + ".",
+		"Expired": true,
+	})
+}
+
+func mfaIssuer() string {
+	if issuer := os.Getenv("MFA_ISSUER"); issuer != "" {
+		return issuer
+	}
+	if u, err := url.Parse(os.Getenv("APP_URL")); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "sso-server"
+}
+
+// confirmedTOTP returns the user's confirmed authenticator, or nil.
+func (ac *AuthController) confirmedTOTP(userID uuid.UUID) *models.TOTPCredential {
+	var cred models.TOTPCredential
+	if err := ac.DB.Where("user_id = ? AND confirmed_at IS NOT NULL", userID).First(&cred).Error; err != nil {
+		return nil
+	}
+	return &cred
+}
+
+// mfaRequired reports whether signing user in takes a second factor: either
+// they set one up or their role demands it. user.Role must be loaded.
+func (ac *AuthController) mfaRequired(user *models.User) bool {
+	return user.Role.RequireMFA || ac.confirmedTOTP(user.ID) != nil
+}
+
+// sessionSatisfiesMFA reports whether session is strong enough for user,
+// e.g. it was not created before the user enrolled or the role started
+// requiring a second factor.
+func (ac *AuthController) sessionSatisfiesMFA(session *ssoSession, user *models.User) bool {
+	return session.MFA || !ac.mfaRequired(user)
+}
+
+// resumeAuthorizeURL is the authorization request to continue after the
+// second factor, without the prompt values and max_age that would ask for
+// the password again. The session it resumes with was just created, so
+// max_age is already satisfied; keeping max_age=0 would loop forever.
+func resumeAuthorizeURL(c *fiber.Ctx) string {
+	query, _ := url.ParseQuery(string(c.Request().URI().QueryString()))
+	query.Del("max_age")
+	if prompt := query.Get("prompt"); prompt != "" {
+		kept := slices.DeleteFunc(strings.Fields(prompt), func(p string) bool {
+			return p == "login" || p == "select_account"
+		})
+		if len(kept) == 0 {
+			query.Del("prompt")
+		} else {
+			query.Set("prompt", strings.Join(kept, " "))
+		}
+	}
+	return os.Getenv("APP_URL") + "/authorize?" + query.Encode()
+}
+
+// startSecondFactor parks a password-authenticated login and shows the
+// second factor page, or the enrollment page when the user's role requires
+// a factor they do not have yet.
+func (ac *AuthController) startSecondFactor(c *fiber.Ctx, user *models.User, remember bool, resume string) error {
+	if ac.mfaLocked(c, user.ID) {
+		return ac.renderMFALocked(c)
+	}
+	pending := mfaPending{UserID: user.ID.String(), Remember: remember, Resume: resume}
+	if ac.confirmedTOTP(user.ID) == nil {
+		secret, err := helper.GenerateTOTPSecret()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"message": "failed to start enrollment"})
+		}
+		pending.EnrollSecret = secret
+	}
+	token, err := helper.GenerateOpaqueToken()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "failed to start second factor"})
+	}
+	data, _ := json.Marshal(pending)
+	if err := ac.Redis.Set(c.Context(), mfaPendingKey(token), data, mfaPendingTTL).Err(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "failed to start second factor"})
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     mfaPendingCookie,
+		Value:    token,
+		Path:     "/mfa",
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return ac.renderSecondFactor(c, user, &pending, "")
+}
+
+func (ac *AuthController) renderSecondFactor(c *fiber.Ctx, user *models.User, pending *mfaPending, errMsg string) error {
+	if pending.EnrollSecret != "" {
+		uri := helper.TOTPProvisioningURI(pending.EnrollSecret, user.Email, mfaIssuer())
+		qr, err := helper.TOTPQRCode(uri)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"message": "failed to render QR code"})
+		}
+		// Neither otpauth: nor data: URIs pass html/template on their own.
+		return c.Render("mfa_enroll", fiber.Map{
+			"AppUrl":          os.Getenv("APP_URL"),
+			"Secret":          pending.EnrollSecret,
+			"ProvisioningURI": template.URL(uri),
+			"QRCode":          template.URL(qr),
+			"Error":           errMsg,
+		})
+	}
+	return c.Render("mfa", fiber.Map{
+		"AppUrl": os.Getenv("APP_URL"),
+		"Error":  errMsg,
+	})
+}
+
+// pendingLogin loads the parked login for the mfa_pending cookie.
+func (ac *AuthController) pendingLogin(c *fiber.Ctx) (*mfaPending, *models.User) {
+	token := c.Cookies(mfaPendingCookie)
+	if token == "" {
+		return nil, nil
+	}
+	data, err := ac.Redis.Get(c.Context(), mfaPendingKey(token)).Bytes()
+	if err != nil {
+		return nil, nil
+	}
+	var pending mfaPending
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, nil
+	}
+	var user models.User
+	if err := ac.DB.Preload("Role").First(&user, "id = ?", pending.UserID).Error; err != nil || user.Disabled() {
+		return nil, nil
+	}
+	return &pending, &user
+}
+
+func (ac *AuthController) clearPendingLogin(c *fiber.Ctx) {
+	ac.Redis.Del(c.Context(), mfaPendingKey(c.Cookies(mfaPendingCookie)))
+	c.Cookie(&fiber.Cookie{
+		Name:     mfaPendingCookie,
+		Value:    "",
+		Path:     "/mfa",
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+		Expires:  time.Unix(0, 0),
+	})
+}
+
+func (ac *AuthController) renderMFAExpired(c *fiber.Ctx) error {
+	return c.Status(400).Render("mfa", fiber.Map{
+		"AppUrl":  os.Getenv("APP_URL"),
+		"Error":   "Your sign-in has expired. Please go back to the application and sign in again.",
+		"Expired": true,
+	})
+}
+
+func (ac *AuthController) ShowSecondFactor(c *fiber.Ctx) error {
+	pending, user := ac.pendingLogin(c)
+	if pending == nil {
+		return ac.renderMFAExpired(c)
+	}
+	return ac.renderSecondFactor(c, user, pending, "")
+}
+
+// VerifySecondFactor finishes a parked login with a code from the
+// authenticator app or a recovery code, then continues where the login
+// started. During enrollment the code confirms the new authenticator and the
+// recovery codes are shown once.
+func (ac *AuthController) VerifySecondFactor(c *fiber.Ctx) error {
+	pending, user := ac.pendingLogin(c)
+	if pending == nil {
+		return ac.renderMFAExpired(c)
+	}
+	if ac.mfaLocked(c, user.ID) {
+		ac.clearPendingLogin(c)
+		return ac.renderMFALocked(c)
+	}
+	var req dto.MFARequest
+	if err := c.BodyParser(&req); err != nil || validateStruct(req) != nil {
+		return ac.renderSecondFactor(c, user, pending, "Please enter a code")
+	}
+
+	var recoveryCodes []string
+	var err error
+	if pending.EnrollSecret != "" {
+		recoveryCodes, err = ac.enrollTOTP(user.ID, pending.EnrollSecret, req.Code)
+	} else {
+		err = ac.checkSecondFactor(user.ID, req.Code)
+	}
+	if err != nil {
+		ac.recordMFAFailure(c, user)
+		pending.Attempts++
+		if ac.mfaLocked(c, user.ID) {
+			ac.clearPendingLogin(c)
+			return ac.renderMFALocked(c)
+		}
+		if pending.Attempts >= maxMFAAttempts {
+			ac.clearPendingLogin(c)
+			return ac.renderMFAExpired(c)
+		}
+		data, _ := json.Marshal(pending)
+		ac.Redis.Set(c.Context(), mfaPendingKey(c.Cookies(mfaPendingCookie)), data, redis.KeepTTL)
+		c.Status(fiber.StatusUnauthorized)
+		return ac.renderSecondFactor(c, user, pending, "That code is not valid. Please try again.")
+	}
+
+	ac.clearPendingLogin(c)
+	ac.Redis.Del(c.Context(), mfaFailuresKey(user.ID))
+	if _, err := ac.createSession(c, user, pending.Remember, true); err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "failed to store session"})
+	}
+	if recoveryCodes != nil {
+		return c.Render("mfa_recovery", fiber.Map{
+			"AppUrl":        os.Getenv("APP_URL"),
+			"RecoveryCodes": recoveryCodes,
+			"Continue":      pending.Resume,
+		})
+	}
+	return c.Redirect(pending.Resume)
+}
+
+// checkSecondFactor accepts a current TOTP code that has not been used
+// before, or an unused recovery code, which is then spent.
+func (ac *AuthController) checkSecondFactor(userID uuid.UUID, code string) error {
+	cred := ac.confirmedTOTP(userID)
+	if cred == nil {
+		return errInvalidSecondFactor
+	}
+	if counter, ok := helper.ValidateTOTP(cred.Secret, code, time.Now()); ok {
+		res := ac.DB.Model(cred).Where("last_counter < ?", counter).Update("last_counter", counter)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return errInvalidSecondFactor
+		}
+		return nil
+	}
+	res := ac.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, helper.HashToken(helper.NormalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if res.Error != nil || res.RowsAffected == 0 {
+		return errInvalidSecondFactor
+	}
+	return nil
+}
+
+// enrollTOTP confirms secret with a code from the user's authenticator app,
+// stores it and returns a fresh set of recovery codes.
+func (ac *AuthController) enrollTOTP(userID uuid.UUID, secret, code string) ([]string, error) {
+	counter, ok := helper.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, errInvalidSecondFactor
+	}
+	codes, err := helper.GenerateRecoveryCodes(recoveryCodeN)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.TOTPCredential{}).Error; err != nil {
+			return err
+		}
+		cred := models.TOTPCredential{ID: uuid.New(), UserID: userID, Secret: secret, ConfirmedAt: &now, LastCounter: counter}
+		if err := tx.Create(&cred).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, codes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID, codes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	records := make([]models.RecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		records = append(records, models.RecoveryCode{ID: uuid.New(), UserID: userID, CodeHash: helper.HashToken(code)})
+	}
+	return tx.Create(&records).Error
+}
+
+// MFAStatus reports whether the user has an authenticator set up, whether
+// their role requires one and how many recovery codes are left.
+func (ac *AuthController) MFAStatus(c *fiber.Ctx) error {
+	user, err := ac.accountUser(c)
+	if user == nil {
+		return err
+	}
+	var role models.Role
+	ac.DB.First(&role, "id = ?", user.RoleID)
+	var remaining int64
+	ac.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+	return c.JSON(fiber.Map{
+		"totp_enabled":             ac.confirmedTOTP(user.ID) != nil,
+		"required":                 role.RequireMFA,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// StartTOTPEnrollment creates an unconfirmed authenticator and returns its
+// secret after checking current_password. It only takes effect once
+// ConfirmTOTPEnrollment sees a code generated from it.
+func (ac *AuthController) StartTOTPEnrollment(c *fiber.Ctx) error {
+	user, err := ac.accountUser(c)
+	if user == nil {
+		return err
+	}
+	if ok, err := ac.confirmPassword(c, user); !ok {
+		return err
+	}
+	if ac.confirmedTOTP(user.ID) != nil {
+		return c.Status(409).JSON(fiber.Map{"message": "an authenticator is already set up"})
+	}
+	secret, err := helper.GenerateTOTPSecret()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not start enrollment"})
+	}
+	err = ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.TOTPCredential{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TOTPCredential{ID: uuid.New(), UserID: user.ID, Secret: secret}).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not start enrollment"})
+	}
+	uri := helper.TOTPProvisioningURI(secret, user.Email, mfaIssuer())
+	qr, err := helper.TOTPQRCode(uri)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not start enrollment"})
+	}
+	return c.JSON(fiber.Map{
+		"secret":           secret,
+		"provisioning_uri": uri,
+		"qr_code":          qr,
+	})
+}
+
+// ConfirmTOTPEnrollment activates the pending authenticator after checking
+// current_password and returns the recovery codes. They are not stored in
+// plaintext and cannot be shown again.
+func (ac *AuthController) ConfirmTOTPEnrollment(c *fiber.Ctx) error {
+	user, err := ac.accountUser(c)
+	if user == nil {
+		return err
+	}
+	if ok, err := ac.confirmPassword(c, user); !ok {
+		return err
+	}
+	var req dto.MFARequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	if errs := validateStruct(req); errs != nil {
+		return c.Status(400).JSON(fiber.Map{"message": "validation error", "errors": errs})
+	}
+	var cred models.TOTPCredential
+	if err := ac.DB.Where("user_id = ? AND confirmed_at IS NULL", user.ID).First(&cred).Error; err != nil {
+		return c.Status(409).JSON(fiber.Map{"message": "no enrollment in progress"})
+	}
+	codes, err := ac.enrollTOTP(user.ID, cred.Secret, req.Code)
+	if errors.Is(err, errInvalidSecondFactor) {
+		return c.Status(400).JSON(fiber.Map{"message": "code is not valid"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not confirm authenticator"})
+	}
+	go ac.sendMail(user.Email, "Two-factor authentication enabled",
+		"An authenticator app was added to your account. You will be asked for a code when you sign in.\n\n"+
+			"If this was not you, reset your password immediately at "+os.Getenv("APP_URL")+"/forgot-password.")
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// DisableTOTP removes the user's authenticator and recovery codes, unless
+// their role requires a second factor.
+func (ac *AuthController) DisableTOTP(c *fiber.Ctx) error {
+	user, err := ac.accountUser(c)
+	if user == nil {
+		return err
+	}
+	if ok, err := ac.confirmPassword(c, user); !ok {
+		return err
+	}
+	var role models.Role
+	if err := ac.DB.First(&role, "id = ?", user.RoleID).Error; err == nil && role.RequireMFA {
+		return c.Status(409).JSON(fiber.Map{"message": "your role requires two-factor authentication"})
+	}
+	if err := ac.resetMFA(user.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not disable two-factor authentication"})
+	}
+	go ac.sendMail(user.Email, "Two-factor authentication disabled",
+		"The authenticator app was removed from your account.\n\n"+
+			"If this was not you, reset your password immediately at "+os.Getenv("APP_URL")+"/forgot-password.")
+	return c.JSON(fiber.Map{"message": "two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes; the old ones
+// stop working.
+func (ac *AuthController) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	user, err := ac.accountUser(c)
+	if user == nil {
+		return err
+	}
+	if ok, err := ac.confirmPassword(c, user); !ok {
+		return err
+	}
+	if ac.confirmedTOTP(user.ID) == nil {
+		return c.Status(409).JSON(fiber.Map{"message": "two-factor authentication is not enabled"})
+	}
+	codes, err := helper.GenerateRecoveryCodes(recoveryCodeN)
+	if err == nil {
+		err = ac.DB.Transaction(func(tx *gorm.DB) error {
+			return replaceRecoveryCodes(tx, user.ID, codes)
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not generate recovery codes"})
+	}
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// confirmPassword checks the current_password in the request body. When it
+// returns false the error response has already been written.
+func (ac *AuthController) confirmPassword(c *fiber.Ctx, user *models.User) (bool, error) {
+	var req dto.ConfirmPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return false, c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	if errs := validateStruct(req); errs != nil {
+		return false, c.Status(400).JSON(fiber.Map{"message": "validation error", "errors": errs})
+	}
+	return ac.checkCurrentPassword(c, user, req.CurrentPassword)
+}
+
+// resetMFA removes every second factor of the user.
+func (ac *AuthController) resetMFA(userID uuid.UUID) error {
+	return ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.TOTPCredential{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
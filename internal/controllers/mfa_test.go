@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestResumeAuthorizeURLDropsMaxAge(t *testing.T) {
+	t.Setenv("APP_URL", "https://sso.example.com")
+	app := fiber.New()
+	app.Post("/authorize", func(c *fiber.Ctx) error {
+		return c.SendString(resumeAuthorizeURL(c))
+	})
+	// A client demanding max_age=0 with MFA must not be sent back to the
+	// password form after the second factor.
+	resp, err := app.Test(httptest.NewRequest("POST", "/authorize?client_id=app&max_age=0&prompt=login+consent", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resume, err := url.Parse(string(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := resume.Query()
+	if query.Has("max_age") {
+		t.Errorf("resume URL keeps max_age: %s", resume)
+	}
+	if got := query.Get("prompt"); got != "consent" {
+		t.Errorf("prompt = %q, want %q", got, "consent")
+	}
+	if got := query.Get("client_id"); got != "app" {
+		t.Errorf("client_id = %q, want %q", got, "app")
+	}
+}
+
+func TestEnrollmentRequiresCurrentPassword(t *testing.T) {
+	// The failure counter is best effort, so an unreachable Redis still
+	// exercises every rejection.
+	ac := &AuthController{Redis: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})}
+	user := &models.User{ID: uuid.New(), PasswordHash: helper.GeneratePassword("correct horse")}
+	app := fiber.New()
+	app.Post("/me/mfa/totp", func(c *fiber.Ctx) error {
+		if ok, err := ac.confirmPassword(c, user); !ok {
+			return err
+		}
+		return c.SendStatus(204)
+	})
+	for _, tt := range []struct {
+		body string
+		want int
+	}{
+		{`{}`, 400},
+		{`{"code":"123456"}`, 400},
+		{`{"current_password":"wrong","code":"123456"}`, 403},
+		{`{"current_password":"correct horse","code":"123456"}`, 204},
+	} {
+		req := httptest.NewRequest("POST", "/me/mfa/totp", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.body, resp.StatusCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package controllers
+
+import (
+	"net/url"
+	"os"
+	"slices"
+	"sso-server/internal/dto"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+var supportedGrantTypes = map[string]bool{
+	"authorization_code": true,
+	"refresh_token":      true,
+	"client_credentials": true,
+}
+
+// oauthError is an RFC 6749 error response. Depending on where it occurs it
+// is either rendered as JSON or appended to the client's redirect URI.
+type oauthError struct {
+	Code        string
+	Description string
+	Status      int
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func (e *oauthError) JSON(c *fiber.Ctx) error {
+	status := e.Status
+	if status == 0 {
+		status = fiber.StatusBadRequest
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":             e.Code,
+		"error_description": e.Description,
+	})
+}
+
+// redirect sends the error back to the client as described in RFC 6749 section 4.1.2.1.
+func (e *oauthError) redirect(c *fiber.Ctx, redirectURI, state string) error {
+	params := url.Values{
+		"error":             {e.Code},
+		"error_description": {e.Description},
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+	return c.Redirect(appendQuery(redirectURI, params))
+}
+
+// parseAuthorizeRequest validates the client and redirect URI of an
+// authorization request. Errors returned here must not be redirected since
+// the redirect target itself is untrusted.
+func (ac *AuthController) parseAuthorizeRequest(c *fiber.Ctx) (*dto.AuthorizeRequest, *models.Client, *oauthError) {
+	var req dto.AuthorizeRequest
+	if err := c.QueryParser(&req); err != nil {
+		return nil, nil, &oauthError{Code: "invalid_request", Description: err.Error()}
+	}
+	client, err := ac.findClient(req.ClientID)
+	if err != nil {
+		return nil, nil, &oauthError{Code: "invalid_client", Description: "unknown client_id"}
+	}
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, nil, &oauthError{Code: "invalid_request", Description: "redirect_uri is not registered for this client"}
+	}
+	return &req, client, nil
+}
+
+// checkAuthorizeRequest validates the parts of an authorization request that
+// can be reported back to the client via its redirect URI.
+func (ac *AuthController) checkAuthorizeRequest(req *dto.AuthorizeRequest, client *models.Client) *oauthError {
+	if req.ResponseType != "code" {
+		return &oauthError{Code: "unsupported_response_type", Description: "only response_type=code is supported"}
+	}
+	if !client.AllowsGrantType("authorization_code") {
+		return &oauthError{Code: "unauthorized_client", Description: "client may not use the authorization code grant"}
+	}
+	prompts := strings.Fields(req.Prompt)
+	for _, prompt := range prompts {
+		if !slices.Contains([]string{"none", "login", "consent", "select_account"}, prompt) {
+			return &oauthError{Code: "invalid_request", Description: "unsupported prompt value " + prompt}
+		}
+	}
+	if slices.Contains(prompts, "none") && len(prompts) > 1 {
+		return &oauthError{Code: "invalid_request", Description: "prompt=none cannot be combined with other values"}
+	}
+	if req.MaxAge != "" {
+		if maxAge, err := strconv.Atoi(req.MaxAge); err != nil || maxAge < 0 {
+			return &oauthError{Code: "invalid_request", Description: "max_age must be a non-negative integer"}
+		}
+	}
+	method, err := ac.checkPKCE(client, req.CodeChallenge, req.CodeChallengeMethod)
+	if err != nil {
+		return &oauthError{Code: "invalid_request", Description: err.Error()}
+	}
+	req.CodeChallengeMethod = method
+	return nil
+}
+
+func (ac *AuthController) renderAuthorizeLogin(c *fiber.Ctx, errorMessage string) error {
+	return c.Render("login", fiber.Map{
+		"FormAction": os.Getenv("APP_URL") + "/authorize?" + string(c.Request().URI().QueryString()),
+		"AppUrl":     os.Getenv("APP_URL"),
+		"Error":      errorMessage,
+	})
+}
+
+func (ac *AuthController) ShowAuthorize(c *fiber.Ctx) error {
+	req, client, oerr := ac.parseAuthorizeRequest(c)
+	if oerr != nil {
+		return oerr.JSON(c)
+	}
+	if oerr := ac.checkAuthorizeRequest(req, client); oerr != nil {
+		return oerr.redirect(c, req.RedirectURI, req.State)
+	}
+	promptNone := slices.Contains(strings.Fields(req.Prompt), "none")
+	session, user := ac.currentSession(c)
+	if oerr := authorizeInteraction(req, session); oerr != nil {
+		if promptNone {
+			return oerr.redirect(c, req.RedirectURI, req.State)
+		}
+		return ac.renderAuthorizeLogin(c, "")
+	}
+	if !ac.sessionSatisfiesMFA(session, user) {
+		if promptNone {
+			return (&oauthError{Code: "interaction_required", Description: "a second factor is required"}).redirect(c, req.RedirectURI, req.State)
+		}
+		return ac.renderAuthorizeLogin(c, "")
+	}
+	if emailVerificationRequired(client, user) {
+		if promptNone {
+			return (&oauthError{Code: "access_denied", Description: "the user's email address is not verified"}).redirect(c, req.RedirectURI, req.State)
+		}
+		return ac.renderVerifyEmailRequired(c, client, user)
+	}
+	if ac.needsConsent(user, client, req) {
+		if promptNone {
+			return (&oauthError{Code: "consent_required", Description: "the user has not approved this client"}).redirect(c, req.RedirectURI, req.State)
+		}
+		return ac.renderConsent(c, req, client, session)
+	}
+	return ac.completeAuthorization(c, req, client, user, session)
+}
+
+// authorizeInteraction decides whether the user has to interact before a
+// code can be issued from the existing SSO session. The returned error is
+// what a prompt=none request gets back.
+func authorizeInteraction(req *dto.AuthorizeRequest, session *ssoSession) *oauthError {
+	if session == nil {
+		return &oauthError{Code: "login_required", Description: "no active session"}
+	}
+	prompts := strings.Fields(req.Prompt)
+	if slices.Contains(prompts, "login") || slices.Contains(prompts, "select_account") {
+		return &oauthError{Code: "login_required", Description: "re-authentication requested"}
+	}
+	if req.MaxAge != "" {
+		maxAge, _ := strconv.Atoi(req.MaxAge)
+		if time.Since(time.Unix(session.AuthTime, 0)) > time.Duration(maxAge)*time.Second {
+			return &oauthError{Code: "login_required", Description: "authentication is older than max_age"}
+		}
+	}
+	return nil
+}
+
+func (ac *AuthController) Authorize(c *fiber.Ctx) error {
+	req, client, oerr := ac.parseAuthorizeRequest(c)
+	if oerr != nil {
+		return oerr.JSON(c)
+	}
+	if oerr := ac.checkAuthorizeRequest(req, client); oerr != nil {
+		return oerr.redirect(c, req.RedirectURI, req.State)
+	}
+
+	var login dto.LoginRequest
+	if err := c.BodyParser(&login); err != nil {
+		return ac.renderAuthorizeLogin(c, "Invalid login request")
+	}
+	user, err := ac.authenticateUser(login.Email, login.Password)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return ac.renderAuthorizeLogin(c, loginErrorMessage(err))
+	}
+	if emailVerificationRequired(client, user) {
+		return ac.renderVerifyEmailRequired(c, client, user)
+	}
+	if ac.mfaRequired(user) {
+		return ac.startSecondFactor(c, user, login.Remember != "", resumeAuthorizeURL(c))
+	}
+	session, err := ac.createSession(c, user, login.Remember != "", false)
+	if err != nil {
+		return (&oauthError{Code: "server_error", Description: "failed to start session"}).redirect(c, req.RedirectURI, req.State)
+	}
+	if ac.needsConsent(user, client, req) {
+		return ac.renderConsent(c, req, client, session)
+	}
+	return ac.completeAuthorization(c, req, client, user, session)
+}
+
+// completeAuthorization issues the authorization code for an authenticated
+// user and sends it back to the client.
+func (ac *AuthController) completeAuthorization(c *fiber.Ctx, req *dto.AuthorizeRequest, client *models.Client, user *models.User, session *ssoSession) error {
+	code, err := ac.issueAuthCode(c.Context(), authCode{
+		UserID:      user.ID.String(),
+		ClientID:    client.ClientID,
+		RedirectURI: req.RedirectURI,
+		Scope:       req.Scope,
+		Nonce:       req.Nonce,
+		AuthTime:    session.AuthTime,
+		SessionID:   session.SID,
+		MFA:         session.MFA,
+
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	})
+	if err == nil {
+		err = ac.trackSessionClient(c.Context(), session, client.ClientID)
+	}
+	if err != nil {
+		return (&oauthError{Code: "server_error", Description: "failed to store authorization code"}).redirect(c, req.RedirectURI, req.State)
+	}
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return c.Redirect(appendQuery(req.RedirectURI, params))
+}
+
+// Token implements the RFC 6749 token endpoint.
+func (ac *AuthController) Token(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set("Pragma", "no-cache")
+
+	var req dto.TokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return (&oauthError{Code: "invalid_request", Description: "malformed token request"}).JSON(c)
+	}
+	client, err := ac.authenticateClient(c, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return invalidClient(c)
+	}
+	if !supportedGrantTypes[req.GrantType] {
+		return (&oauthError{Code: "unsupported_grant_type", Description: "unsupported grant_type"}).JSON(c)
+	}
+	if !client.AllowsGrantType(req.GrantType) {
+		return (&oauthError{Code: "unauthorized_client", Description: "client may not use this grant type"}).JSON(c)
+	}
+
+	switch req.GrantType {
+	case "authorization_code":
+		return ac.tokenFromAuthorizationCode(c, &req, client)
+	case "refresh_token":
+		return ac.tokenFromRefreshToken(c, &req, client)
+	case "client_credentials":
+		return ac.tokenFromClientCredentials(c, &req, client)
+	default:
+		return (&oauthError{Code: "unsupported_grant_type", Description: "unsupported grant_type"}).JSON(c)
+	}
+}
+
+func (ac *AuthController) tokenFromAuthorizationCode(c *fiber.Ctx, req *dto.TokenRequest, client *models.Client) error {
+	code, err := ac.consumeAuthCode(c.Context(), req.Code)
+	if err != nil {
+		return (&oauthError{Code: "invalid_grant", Description: err.Error()}).JSON(c)
+	}
+	if code.ClientID != client.ClientID {
+		return (&oauthError{Code: "invalid_grant", Description: "code was not issued to this client"}).JSON(c)
+	}
+	if code.RedirectURI != req.RedirectURI {
+		return (&oauthError{Code: "invalid_grant", Description: "redirect_uri does not match the authorization request"}).JSON(c)
+	}
+	if err := verifyPKCE(client, code, req.CodeVerifier); err != nil {
+		return (&oauthError{Code: "invalid_grant", Description: err.Error()}).JSON(c)
+	}
+
+	var user models.User
+	if err := ac.DB.Preload("Role.Permissions").First(&user, "id = ?", code.UserID).Error; err != nil {
+		return (&oauthError{Code: "invalid_grant", Description: "user no longer exists"}).JSON(c)
+	}
+	if user.Disabled() {
+		return (&oauthError{Code: "invalid_grant", Description: "user account is disabled"}).JSON(c)
+	}
+	if !code.MFA && ac.mfaRequired(&user) {
+		return (&oauthError{Code: "invalid_grant", Description: "a second factor is required"}).JSON(c)
+	}
+	return ac.issueTokens(c, tokenIssue{
+		User:      user,
+		Client:    client,
+		Scope:     code.Scope,
+		Nonce:     code.Nonce,
+		AuthTime:  time.Unix(code.AuthTime, 0),
+		SessionID: code.SessionID,
+		MFA:       code.MFA,
+	})
+}
+
+// tokenFromClientCredentials issues a service token for the client itself.
+// Only the scopes registered for the client can be requested; no refresh
+// token is issued since the client can simply authenticate again.
+func (ac *AuthController) tokenFromClientCredentials(c *fiber.Ctx, req *dto.TokenRequest, client *models.Client) error {
+	if client.Public {
+		return (&oauthError{Code: "unauthorized_client", Description: "public clients cannot use client_credentials"}).JSON(c)
+	}
+	scope := strings.Join(client.Scopes, " ")
+	if req.Scope != "" {
+		for _, s := range strings.Fields(req.Scope) {
+			if !slices.Contains(client.Scopes, s) {
+				return (&oauthError{Code: "invalid_scope", Description: "scope " + s + " is not assigned to this client"}).JSON(c)
+			}
+		}
+		scope = req.Scope
+	}
+	if err := ac.DB.Model(client).Association("Permissions").Find(&client.Permissions); err != nil {
+		return (&oauthError{Code: "server_error", Description: "could not load client permissions", Status: fiber.StatusInternalServerError}).JSON(c)
+	}
+
+	accessToken, err := helper.GenerateClientToken(*client, scope, ac.Keys)
+	if err != nil {
+		return (&oauthError{Code: "server_error", Description: "token generation failed", Status: fiber.StatusInternalServerError}).JSON(c)
+	}
+	resp := fiber.Map{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(helper.AccessTokenTTL.Seconds()),
+	}
+	if scope != "" {
+		resp["scope"] = scope
+	}
+	return c.JSON(resp)
+}
+
+// accessTokenGrant applies the client's claim selection and releases the
+// user's permissions for permissionScope. user.Role.Permissions must be
+// loaded.
+func accessTokenGrant(user models.User, client *models.Client, scope, permissionScope string) helper.TokenGrant {
+	grant := helper.TokenGrant{
+		ClientID:    client.ClientID,
+		Scope:       scope,
+		Permissions: helper.EffectivePermissions(user.Role.Permissions, permissionScope, client.Audiences),
+	}
+	if len(client.AccessTokenClaims) > 0 {
+		grant.Claims = client.AccessTokenClaims
+	}
+	return grant
+}
+
+// tokenIssue is everything needed to build a successful token response.
+type tokenIssue struct {
+	User     models.User
+	Client   *models.Client
+	Scope    string
+	Nonce    string
+	AuthTime time.Time
+	// GrantedScope is stored with the refresh token when the access token
+	// was issued for a narrower Scope. Defaults to Scope.
+	GrantedScope string
+	// FamilyID continues an existing refresh token family on rotation.
+	FamilyID uuid.UUID
+	// SessionID ties the tokens to the SSO session they were issued under.
+	SessionID string
+	// MFA is carried over to the refresh token so refreshes can insist on a
+	// second factor.
+	MFA bool
+}
+
+func (ac *AuthController) issueTokens(c *fiber.Ctx, issue tokenIssue) error {
+	serverError := &oauthError{Code: "server_error", Description: "token generation failed", Status: fiber.StatusInternalServerError}
+	grant := accessTokenGrant(issue.User, issue.Client, issue.Scope, issue.Scope)
+	grant.AuthTime = issue.AuthTime
+	grant.SessionID = issue.SessionID
+	accessToken, err := helper.GenerateToken(issue.User, grant, ac.Keys)
+	if err != nil {
+		return serverError.JSON(c)
+	}
+
+	resp := fiber.Map{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(helper.AccessTokenTTL.Seconds()),
+	}
+	if issue.Scope != "" {
+		resp["scope"] = issue.Scope
+	}
+	if issue.Client.AllowsGrantType("refresh_token") {
+		grantedScope := issue.GrantedScope
+		if grantedScope == "" {
+			grantedScope = issue.Scope
+		}
+		refreshToken, err := ac.issueRefreshToken(models.RefreshToken{
+			FamilyID:  issue.FamilyID,
+			UserID:    issue.User.ID,
+			ClientID:  issue.Client.ClientID,
+			SessionID: issue.SessionID,
+			Scope:     grantedScope,
+			AuthTime:  issue.AuthTime,
+			MFA:       issue.MFA,
+		})
+		if err != nil {
+			return serverError.JSON(c)
+		}
+		resp["refresh_token"] = refreshToken
+	}
+	if hasScope(issue.Scope, "openid") {
+		var profile models.UserProfile
+		ac.DB.Where("user_id = ?", issue.User.ID).First(&profile)
+		idToken, err := helper.GenerateIDToken(issue.User, helper.IDTokenRequest{
+			ClientID:  issue.Client.ClientID,
+			Nonce:     issue.Nonce,
+			AuthTime:  issue.AuthTime,
+			SessionID: issue.SessionID,
+			Claims:    helper.UserClaims(issue.User, profile, issue.Scope),
+		}, ac.Keys)
+		if err != nil {
+			return serverError.JSON(c)
+		}
+		resp["id_token"] = idToken
+	}
+	return c.JSON(resp)
+}
+
+// invalidClient answers a failed client authentication as RFC 6749 section 5.2 requires.
+func invalidClient(c *fiber.Ctx) error {
+	if strings.HasPrefix(c.Get(fiber.HeaderAuthorization), "Basic ") {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="sso-server"`)
+	}
+	return (&oauthError{Code: "invalid_client", Description: "client authentication failed", Status: fiber.StatusUnauthorized}).JSON(c)
+}
+
+// hasScope reports whether the space-delimited scope string contains want.
+func hasScope(scope, want string) bool {
+	return slices.Contains(strings.Fields(scope), want)
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"errors"
+	"slices"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Discovery serves the OpenID Provider metadata document.
+func (ac *AuthController) Discovery(c *fiber.Ctx) error {
+	issuer := helper.Issuer()
+	codeChallengeMethods := []string{helper.PKCEMethodS256}
+	if !ac.ForbidPlainPKCE {
+		codeChallengeMethods = append(codeChallengeMethods, helper.PKCEMethodPlain)
+	}
+	grantTypes := make([]string, 0, len(supportedGrantTypes))
+	for grantType := range supportedGrantTypes {
+		grantTypes = append(grantTypes, grantType)
+	}
+	slices.Sort(grantTypes)
+
+	return c.JSON(fiber.Map{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"end_session_endpoint":                  issuer + "/logout",
+		"backchannel_logout_supported":          true,
+		"backchannel_logout_session_supported":  true,
+		"frontchannel_logout_supported":         true,
+		"frontchannel_logout_session_supported": true,
+		"revocation_endpoint":                   issuer + "/revoke",
+		"introspection_endpoint":                issuer + "/introspect",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 grantTypes,
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": ac.Keys.Algorithms(),
+		"userinfo_signing_alg_values_supported": ac.Keys.Algorithms(),
+		"scopes_supported":                      []string{"openid", "profile", "email", "phone"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      codeChallengeMethods,
+		"prompt_values_supported":               []string{"none", "login", "consent", "select_account"},
+		"claims_supported":                      []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "azp", "sid", "email", "email_verified", "name", "nickname", "picture", "locale", "zoneinfo", "updated_at", "phone_number", "phone_number_verified"},
+	})
+}
+
+// JWKS publishes the public signing keys so relying parties can verify tokens
+// without being handed key files out of band.
+func (ac *AuthController) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+	jwks := helper.JWKS{Keys: []helper.JWK{}}
+	for _, key := range ac.Keys.PublishedKeys() {
+		jwk, err := helper.PublicJWK(key.PublicKey, key.Algorithm)
+		if err != nil {
+			continue
+		}
+		jwk.Kid = key.ID
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return c.JSON(jwks)
+}
+
+// UserInfo returns the claims about the authenticated user that the access
+// token's scopes allow. Clients registered with userinfo_signed_response_alg,
+// or callers asking for application/jwt, get a signed JWT instead of JSON.
+func (ac *AuthController) UserInfo(c *fiber.Ctx) error {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid_token"})
+	}
+	tokenClaims, _ := token.Claims.(jwt.MapClaims)
+	scope, _ := tokenClaims["scope"].(string)
+	if !hasScope(scope, "openid") {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="openid"`)
+		return c.Status(403).JSON(fiber.Map{"error": "insufficient_scope"})
+	}
+
+	tokenUser, err := helper.GetUserFromContext(c)
+	if errors.Is(err, helper.ErrClientToken) {
+		return c.Status(403).JSON(fiber.Map{"error": "insufficient_scope", "error_description": "client tokens have no user"})
+	}
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid_token"})
+	}
+	var user models.User
+	if err := ac.DB.First(&user, "id = ?", tokenUser.ID).Error; err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid_token"})
+	}
+	var profile models.UserProfile
+	ac.DB.Where("user_id = ?", user.ID).First(&profile)
+
+	claims := helper.UserClaims(user, profile, scope)
+
+	clientID, _ := tokenClaims["client_id"].(string)
+	signed := strings.Contains(c.Get(fiber.HeaderAccept), "application/jwt")
+	if client, err := ac.findClient(clientID); err == nil && client.UserInfoSignedResponseAlg != "" {
+		signed = true
+	}
+	if !signed {
+		return c.JSON(claims)
+	}
+	jws, err := helper.GenerateUserInfoToken(claims, clientID, ac.Keys)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "server_error"})
+	}
+	c.Set(fiber.HeaderContentType, "application/jwt")
+	return c.SendString(jws)
+}
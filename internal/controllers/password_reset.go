@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"sso-server/internal/dto"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// passwordResetKey stores the user ID for a reset token, keyed by the token's
+// hash so a Redis dump cannot be used to reset passwords.
+func passwordResetKey(token string) string {
+	return "password_reset:" + helper.HashToken(token)
+}
+
+// userPasswordResetKey points at the user's outstanding reset token so that
+// requesting a new link invalidates the previous one.
+func userPasswordResetKey(userID string) string {
+	return "password_reset_user:" + userID
+}
+
+// passwordResetThrottle limits reset emails to one per address per minute.
+func passwordResetThrottle(email string) string {
+	return "password_reset_throttle:" + helper.HashToken(strings.ToLower(email))
+}
+
+const forgotPasswordSent = "If an account exists for that address, we have sent a link to reset its password."
+
+func (ac *AuthController) ShowForgotPassword(c *fiber.Ctx) error {
+	return c.Render("forgot_password", fiber.Map{
+		"AppUrl": os.Getenv("APP_URL"),
+	})
+}
+
+// ForgotPassword emails a reset link. The response is the same whether or
+// not the address belongs to an account, so it cannot be used to probe for
+// registered emails.
+func (ac *AuthController) ForgotPassword(c *fiber.Ctx) error {
+	var req dto.ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil || validateStruct(req) != nil {
+		return c.Status(400).Render("forgot_password", fiber.Map{
+			"AppUrl": os.Getenv("APP_URL"),
+			"Error":  "Please enter a valid email address",
+		})
+	}
+	sent := func() error {
+		return c.Render("forgot_password", fiber.Map{
+			"AppUrl":  os.Getenv("APP_URL"),
+			"Message": forgotPasswordSent,
+		})
+	}
+
+	fresh, err := ac.Redis.SetNX(c.Context(), passwordResetThrottle(req.Email), 1, time.Minute).Result()
+	if err != nil || !fresh {
+		return sent()
+	}
+	var user models.User
+	if err := ac.DB.Where("email = ?", req.Email).First(&user).Error; err != nil || user.Disabled() {
+		return sent()
+	}
+	token, err := ac.issuePasswordResetToken(c.Context(), user.ID)
+	if err != nil {
+		log.Printf("password reset for %s: %v", user.ID, err)
+		return sent()
+	}
+	go ac.sendPasswordResetMail(user.Email, token)
+	return sent()
+}
+
+// issuePasswordResetToken stores a new single-use reset token for userID,
+// replacing any earlier one.
+func (ac *AuthController) issuePasswordResetToken(ctx context.Context, userID uuid.UUID) (string, error) {
+	token, err := helper.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	key := passwordResetKey(token)
+	previous, err := ac.Redis.GetSet(ctx, userPasswordResetKey(userID.String()), key).Result()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+	pipe := ac.Redis.TxPipeline()
+	if previous != "" {
+		pipe.Del(ctx, previous)
+	}
+	pipe.Set(ctx, key, userID.String(), helper.PasswordResetTTL)
+	pipe.Expire(ctx, userPasswordResetKey(userID.String()), helper.PasswordResetTTL)
+	_, err = pipe.Exec(ctx)
+	return token, err
+}
+
+func (ac *AuthController) sendPasswordResetMail(email, token string) {
+	link := os.Getenv("APP_URL") + "/reset-password?" + url.Values{"token": {token}}.Encode()
+	ac.sendMail(email, "Reset your password",
+		"Someone asked to reset the password for your account.\n\n"+
+			"Open this link to choose a new password:\n"+link+"\n\n"+
+			"The link expires in "+helper.PasswordResetTTL.String()+" and can only be used once. "+
+			"If you did not ask for this, you can ignore this email.")
+}
+
+func (ac *AuthController) ShowResetPassword(c *fiber.Ctx) error {
+	token := c.Query("token")
+	data := fiber.Map{
+		"AppUrl": os.Getenv("APP_URL"),
+		"Token":  token,
+	}
+	if n, err := ac.Redis.Exists(c.Context(), passwordResetKey(token)).Result(); token == "" || err != nil || n == 0 {
+		data["Error"] = "This reset link is invalid or has expired. Please request a new one."
+		data["Token"] = ""
+		return c.Status(400).Render("reset_password", data)
+	}
+	return c.Render("reset_password", data)
+}
+
+var errInvalidResetToken = errors.New("reset token expired or invalid")
+
+// ResetPassword sets a new password with a reset token. On success every
+// session and refresh token of the user is revoked, since whoever had the old
+// password may still be signed in.
+func (ac *AuthController) ResetPassword(c *fiber.Ctx) error {
+	var req dto.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).Render("reset_password", fiber.Map{
+			"AppUrl": os.Getenv("APP_URL"),
+			"Error":  "Invalid request",
+		})
+	}
+	if errs := validateStruct(req); errs != nil {
+		return c.Status(400).Render("reset_password", fiber.Map{
+			"AppUrl": os.Getenv("APP_URL"),
+			"Token":  req.Token,
+			"Errors": errs,
+		})
+	}
+
+	userID, err := ac.consumePasswordResetToken(c.Context(), req.Token)
+	if err != nil {
+		return c.Status(400).Render("reset_password", fiber.Map{
+			"AppUrl": os.Getenv("APP_URL"),
+			"Error":  "This reset link is invalid or has expired. Please request a new one.",
+		})
+	}
+	res := ac.DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password_hash":           helper.GeneratePassword(req.Password),
+		"password_reset_required": false,
+		// The reset link was delivered to the address, which proves it.
+		"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+	})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return c.Status(500).Render("reset_password", fiber.Map{
+			"AppUrl": os.Getenv("APP_URL"),
+			"Error":  "Your password could not be changed. Please request a new link.",
+		})
+	}
+	if err := ac.endUserSessions(c.Context(), userID); err != nil {
+		log.Printf("ending sessions after password reset for %s: %v", userID, err)
+	}
+	clearSessionCookie(c)
+	return c.Render("reset_password", fiber.Map{
+		"AppUrl":  os.Getenv("APP_URL"),
+		"Message": "Your password has been changed. You can now sign in with it.",
+	})
+}
+
+// consumePasswordResetToken redeems token exactly once.
+func (ac *AuthController) consumePasswordResetToken(ctx context.Context, token string) (uuid.UUID, error) {
+	value, err := ac.Redis.GetDel(ctx, passwordResetKey(token)).Result()
+	if err != nil {
+		return uuid.Nil, errInvalidResetToken
+	}
+	userID, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, errInvalidResetToken
+	}
+	ac.Redis.Del(ctx, userPasswordResetKey(value))
+	return userID, nil
+}
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"errors"
+	"os"
+	"sso-server/internal/dto"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func mapProfile(user models.User, profile models.UserProfile) fiber.Map {
+	return fiber.Map{
+		"email":          user.Email,
+		"email_verified": user.EmailVerified(),
+		"full_name":      profile.FullName,
+		"display_name":   profile.DisplayName,
+		"avatar_url":     profile.AvatarURL,
+		"locale":         profile.Locale,
+		"timezone":       profile.Timezone,
+		"phone":          profile.Phone,
+		"updated_at":     profile.UpdatedAt,
+	}
+}
+
+// loadProfile returns the user's profile, or an empty one for accounts
+// created before profiles existed.
+func (ac *AuthController) loadProfile(userID uuid.UUID) (models.UserProfile, error) {
+	var profile models.UserProfile
+	err := ac.DB.Where("user_id = ?", userID).First(&profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.UserProfile{UserID: userID}, nil
+	}
+	return profile, err
+}
+
+func profileRequest(profile models.UserProfile) dto.ProfileRequest {
+	return dto.ProfileRequest{
+		FullName:    profile.FullName,
+		DisplayName: profile.DisplayName,
+		AvatarURL:   profile.AvatarURL,
+		Locale:      profile.Locale,
+		Timezone:    profile.Timezone,
+		Phone:       profile.Phone,
+	}
+}
+
+// saveProfile validates req, except for the fields named in skip, and stores
+// it as the user's profile. It returns validation errors, if any, separately
+// from storage errors.
+func (ac *AuthController) saveProfile(profile *models.UserProfile, req dto.ProfileRequest, skip ...string) (map[string]string, error) {
+	if errs := validateStructExcept(req, skip...); errs != nil {
+		return errs, nil
+	}
+	profile.FullName = req.FullName
+	profile.DisplayName = req.DisplayName
+	profile.AvatarURL = req.AvatarURL
+	profile.Locale = req.Locale
+	profile.Timezone = req.Timezone
+	profile.Phone = req.Phone
+	if profile.ID == uuid.Nil {
+		return nil, ac.DB.Create(profile).Error
+	}
+	return nil, ac.DB.Save(profile).Error
+}
+
+func (ac *AuthController) GetProfile(c *fiber.Ctx) error {
+	user, err := ac.accountUser(c)
+	if user == nil {
+		return err
+	}
+	profile, err := ac.loadProfile(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not load profile"})
+	}
+	return c.JSON(mapProfile(*user, profile))
+}
+
+// UpdateProfile changes the fields present in the body. Tokens issued
+// afterwards carry the new values.
+func (ac *AuthController) UpdateProfile(c *fiber.Ctx) error {
+	user, err := ac.accountUser(c)
+	if user == nil {
+		return err
+	}
+	var patch dto.UpdateProfileRequest
+	if err := c.BodyParser(&patch); err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	profile, err := ac.loadProfile(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not load profile"})
+	}
+
+	req := profileRequest(profile)
+	patchField(&req.FullName, patch.FullName)
+	patchField(&req.DisplayName, patch.DisplayName)
+	patchField(&req.AvatarURL, patch.AvatarURL)
+	patchField(&req.Locale, patch.Locale)
+	patchField(&req.Timezone, patch.Timezone)
+	patchField(&req.Phone, patch.Phone)
+	// Accounts without a stored name can change other fields without
+	// having to set one.
+	var skip []string
+	if patch.FullName == nil && profile.FullName == "" {
+		skip = append(skip, "FullName")
+	}
+	valErrors, err := ac.saveProfile(&profile, req, skip...)
+	if valErrors != nil {
+		return c.Status(400).JSON(fiber.Map{"message": "validation error", "errors": valErrors})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not save profile"})
+	}
+	return c.JSON(mapProfile(*user, profile))
+}
+
+func patchField(field *string, value *string) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+// accountCSRFToken is derived from the session cookie, which a cross-site
+// page cannot read, so it needs no storage.
+func accountCSRFToken(c *fiber.Ctx) string {
+	return helper.HashToken("account:" + c.Cookies(ssoSessionCookie))
+}
+
+func (ac *AuthController) renderAccount(c *fiber.Ctx, user *models.User, req dto.ProfileRequest, data fiber.Map) error {
+	view := fiber.Map{
+		"AppUrl":        os.Getenv("APP_URL"),
+		"Email":         user.Email,
+		"EmailVerified": user.EmailVerified(),
+		"Profile":       req,
+		"CSRFToken":     accountCSRFToken(c),
+	}
+	for k, v := range data {
+		view[k] = v
+	}
+	return c.Render("account", view)
+}
+
+func (ac *AuthController) renderAccountLogin(c *fiber.Ctx, errMsg string) error {
+	return c.Render("login", fiber.Map{
+		"FormAction": os.Getenv("APP_URL") + "/account/login",
+		"AppUrl":     os.Getenv("APP_URL"),
+		"Error":      errMsg,
+	})
+}
+
+// ShowAccount renders the account page for the browser's SSO session, or
+// the login form when there is none.
+func (ac *AuthController) ShowAccount(c *fiber.Ctx) error {
+	session, user := ac.currentSession(c)
+	if session == nil || !ac.sessionSatisfiesMFA(session, user) {
+		return ac.renderAccountLogin(c, "")
+	}
+	profile, err := ac.loadProfile(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not load profile"})
+	}
+	return ac.renderAccount(c, user, profileRequest(profile), nil)
+}
+
+// AccountLogin signs the browser in from the account page.
+func (ac *AuthController) AccountLogin(c *fiber.Ctx) error {
+	var login dto.LoginRequest
+	if err := c.BodyParser(&login); err != nil {
+		return ac.renderAccountLogin(c, "Invalid login request")
+	}
+	user, err := ac.authenticateUser(login.Email, login.Password)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return ac.renderAccountLogin(c, loginErrorMessage(err))
+	}
+	if ac.mfaRequired(user) {
+		return ac.startSecondFactor(c, user, login.Remember != "", os.Getenv("APP_URL")+"/account")
+	}
+	if _, err := ac.createSession(c, user, login.Remember != "", false); err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "failed to store session"})
+	}
+	return c.Redirect(os.Getenv("APP_URL") + "/account")
+}
+
+// SaveAccount handles the profile form on the account page.
+func (ac *AuthController) SaveAccount(c *fiber.Ctx) error {
+	session, user := ac.currentSession(c)
+	if session == nil || !ac.sessionSatisfiesMFA(session, user) {
+		return ac.renderAccountLogin(c, "Your session expired, please sign in again")
+	}
+	if c.FormValue("csrf_token") != accountCSRFToken(c) {
+		return c.Status(403).JSON(fiber.Map{"message": "invalid form token"})
+	}
+	var req dto.ProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"message": err.Error()})
+	}
+	profile, err := ac.loadProfile(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"message": "could not load profile"})
+	}
+	valErrors, err := ac.saveProfile(&profile, req)
+	if valErrors != nil {
+		c.Status(400)
+		return ac.renderAccount(c, user, req, fiber.Map{"Errors": valErrors})
+	}
+	if err != nil {
+		c.Status(500)
+		return ac.renderAccount(c, user, req, fiber.Map{"Error": "Your profile could not be saved. Please try again."})
+	}
+	return ac.renderAccount(c, user, req, fiber.Map{"Message": "Your profile has been saved."})
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"errors"
+	"slices"
+	"sso-server/internal/dto"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errInvalidRefreshToken = errors.New("refresh token expired or invalid")
+
+// issueRefreshToken persists a new refresh token and returns its plaintext.
+// A zero FamilyID starts a new family.
+func (ac *AuthController) issueRefreshToken(record models.RefreshToken) (string, error) {
+	token, err := helper.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	if record.FamilyID == uuid.Nil {
+		record.FamilyID = uuid.New()
+	}
+	record.ID = uuid.New()
+	record.TokenHash = helper.HashToken(token)
+	record.ExpiresAt = time.Now().Add(helper.RefreshTokenTTL)
+	if err := ac.DB.Create(&record).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// useRefreshToken marks a refresh token as used so it can be rotated. If the
+// token was already used it is being replayed, which means it leaked: the
+// whole family is revoked so neither the attacker nor the victim can continue.
+func (ac *AuthController) useRefreshToken(token string, client *models.Client) (*models.RefreshToken, error) {
+	var record models.RefreshToken
+	if err := ac.DB.Where("token_hash = ?", helper.HashToken(token)).First(&record).Error; err != nil {
+		return nil, errInvalidRefreshToken
+	}
+	if record.ClientID != client.ClientID {
+		return nil, errInvalidRefreshToken
+	}
+	if record.RevokedAt != nil || time.Now().After(record.ExpiresAt) {
+		return nil, errInvalidRefreshToken
+	}
+
+	res := ac.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", record.ID).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		ac.revokeRefreshFamily(record.FamilyID)
+		return nil, errInvalidRefreshToken
+	}
+	return &record, nil
+}
+
+// revokeSessionRefreshTokens revokes every refresh token issued under the
+// SSO session sid.
+func (ac *AuthController) revokeSessionRefreshTokens(sid string) error {
+	return ac.DB.Model(&models.RefreshToken{}).
+		Where("session_id = ? AND revoked_at IS NULL", sid).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeRefreshTokensWithoutMFA revokes the refresh tokens of the users
+// selected by userIDs that were issued without a second factor.
+func (ac *AuthController) revokeRefreshTokensWithoutMFA(userIDs *gorm.DB) error {
+	return ac.DB.Model(&models.RefreshToken{}).
+		Where("user_id IN (?) AND NOT mfa AND revoked_at IS NULL", userIDs).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (ac *AuthController) revokeRefreshFamily(familyID uuid.UUID) error {
+	return ac.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (ac *AuthController) tokenFromRefreshToken(c *fiber.Ctx, req *dto.TokenRequest, client *models.Client) error {
+	if req.RefreshToken == "" {
+		return (&oauthError{Code: "invalid_request", Description: "refresh_token is required"}).JSON(c)
+	}
+	record, err := ac.useRefreshToken(req.RefreshToken, client)
+	if err != nil {
+		return (&oauthError{Code: "invalid_grant", Description: errInvalidRefreshToken.Error()}).JSON(c)
+	}
+
+	// A narrower scope may be requested for the new access token; the
+	// refresh token keeps the originally granted scope.
+	scope := record.Scope
+	if req.Scope != "" {
+		granted := strings.Fields(record.Scope)
+		for _, s := range strings.Fields(req.Scope) {
+			if !slices.Contains(granted, s) {
+				return (&oauthError{Code: "invalid_scope", Description: "requested scope exceeds the original grant"}).JSON(c)
+			}
+		}
+		scope = req.Scope
+	}
+
+	var user models.User
+	if err := ac.DB.Preload("Role.Permissions").First(&user, "id = ?", record.UserID).Error; err != nil {
+		ac.revokeRefreshFamily(record.FamilyID)
+		return (&oauthError{Code: "invalid_grant", Description: "user no longer exists"}).JSON(c)
+	}
+	if user.Disabled() {
+		ac.revokeRefreshFamily(record.FamilyID)
+		return (&oauthError{Code: "invalid_grant", Description: "user account is disabled"}).JSON(c)
+	}
+	// Families from before the user needed a second factor, e.g. before
+	// their role started requiring one, must not outlive that change.
+	if !record.MFA && ac.mfaRequired(&user) {
+		ac.revokeRefreshFamily(record.FamilyID)
+		return (&oauthError{Code: "invalid_grant", Description: "a second factor is required"}).JSON(c)
+	}
+	return ac.issueTokens(c, tokenIssue{
+		User:         user,
+		Client:       client,
+		Scope:        scope,
+		GrantedScope: record.Scope,
+		AuthTime:     record.AuthTime,
+		FamilyID:     record.FamilyID,
+		SessionID:    record.SessionID,
+		MFA:          record.MFA,
+	})
+}
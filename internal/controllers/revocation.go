@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"sso-server/internal/dto"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Revoke implements RFC 7009. The response is 200 whether or not the token
+// was known, so callers cannot probe for valid tokens.
+func (ac *AuthController) Revoke(c *fiber.Ctx) error {
+	var req dto.RevokeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return (&oauthError{Code: "invalid_request", Description: "malformed revocation request"}).JSON(c)
+	}
+	client, err := ac.authenticateClient(c, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return invalidClient(c)
+	}
+	if req.Token == "" {
+		return (&oauthError{Code: "invalid_request", Description: "token is required"}).JSON(c)
+	}
+
+	if req.TokenTypeHint == "refresh_token" {
+		if !ac.revokeRefreshToken(req.Token, client) {
+			ac.revokeAccessToken(c.Context(), req.Token, client)
+		}
+	} else {
+		if !ac.revokeAccessToken(c.Context(), req.Token, client) {
+			ac.revokeRefreshToken(req.Token, client)
+		}
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// revokeAccessToken denylists the token's jti until it expires. Clients may
+// only revoke tokens issued to them.
+func (ac *AuthController) revokeAccessToken(ctx context.Context, token string, client *models.Client) bool {
+	claims, ok := ac.verifyAccessToken(token)
+	if !ok {
+		return false
+	}
+	if clientID, _ := claims["client_id"].(string); clientID != client.ClientID {
+		return false
+	}
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if jti == "" || err != nil || exp == nil {
+		return false
+	}
+	return ac.Denylist.Revoke(ctx, jti, exp.Time) == nil
+}
+
+func (ac *AuthController) revokeRefreshToken(token string, client *models.Client) bool {
+	var record models.RefreshToken
+	if err := ac.DB.Where("token_hash = ?", helper.HashToken(token)).First(&record).Error; err != nil {
+		return false
+	}
+	if record.ClientID != client.ClientID {
+		return false
+	}
+	return ac.revokeRefreshFamily(record.FamilyID) == nil
+}
+
+// Introspect implements RFC 7662 for confidential clients such as resource
+// servers.
+func (ac *AuthController) Introspect(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	var req dto.IntrospectRequest
+	if err := c.BodyParser(&req); err != nil {
+		return (&oauthError{Code: "invalid_request", Description: "malformed introspection request"}).JSON(c)
+	}
+	client, err := ac.authenticateClient(c, req.ClientID, req.ClientSecret)
+	if err != nil || client.Public {
+		return invalidClient(c)
+	}
+	if req.Token == "" {
+		return (&oauthError{Code: "invalid_request", Description: "token is required"}).JSON(c)
+	}
+
+	if resp, ok := ac.introspectAccessToken(c.Context(), req.Token); ok {
+		return c.JSON(resp)
+	}
+	if resp, ok := ac.introspectRefreshToken(req.Token, client); ok {
+		return c.JSON(resp)
+	}
+	return c.JSON(fiber.Map{"active": false})
+}
+
+func (ac *AuthController) introspectAccessToken(ctx context.Context, token string) (fiber.Map, bool) {
+	claims, ok := ac.verifyAccessToken(token)
+	if !ok {
+		return nil, false
+	}
+	jti, _ := claims["jti"].(string)
+	if revoked, err := ac.Denylist.IsRevoked(ctx, jti); err != nil || revoked {
+		return nil, false
+	}
+	resp := fiber.Map{
+		"active":     true,
+		"token_type": "Bearer",
+	}
+	for _, claim := range []string{"scope", "client_id", "sub", "iss", "aud", "exp", "iat", "jti"} {
+		if v, ok := claims[claim]; ok {
+			resp[claim] = v
+		}
+	}
+	if email, ok := claims["email"]; ok {
+		resp["username"] = email
+	}
+	return resp, true
+}
+
+// introspectRefreshToken only answers for the client the refresh token
+// belongs to; other callers learn nothing about it.
+func (ac *AuthController) introspectRefreshToken(token string, client *models.Client) (fiber.Map, bool) {
+	var record models.RefreshToken
+	if err := ac.DB.Where("token_hash = ?", helper.HashToken(token)).First(&record).Error; err != nil {
+		return nil, false
+	}
+	if record.ClientID != client.ClientID || record.UsedAt != nil || record.RevokedAt != nil || time.Now().After(record.ExpiresAt) {
+		return nil, false
+	}
+	return fiber.Map{
+		"active":     true,
+		"token_type": "refresh_token",
+		"scope":      record.Scope,
+		"client_id":  record.ClientID,
+		"sub":        record.UserID.String(),
+		"exp":        record.ExpiresAt.Unix(),
+		"iat":        record.CreatedAt.Unix(),
+	}, true
+}
+
+func (ac *AuthController) verifyAccessToken(token string) (jwt.MapClaims, bool) {
+	parsed, err := helper.VerifyToken(token, ac.Keys)
+	if err != nil || !parsed.Valid {
+		return nil, false
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	return claims, ok
+}
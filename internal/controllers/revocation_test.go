@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestIntrospectionRejectsIDTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key. Err: %v", err)
+	}
+	keys, err := helper.NewKeySet(time.Hour, &helper.SigningKey{PrivateKey: key})
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+	ac := &AuthController{Keys: keys}
+	user := models.User{ID: uuid.New()}
+
+	accessToken, err := helper.GenerateToken(user, helper.TokenGrant{ClientID: "blog"}, keys)
+	if err != nil {
+		t.Fatalf("error signing access token. Err: %v", err)
+	}
+	if _, ok := ac.verifyAccessToken(accessToken); !ok {
+		t.Errorf("expected access token to verify")
+	}
+
+	idToken, err := helper.GenerateIDToken(user, helper.IDTokenRequest{ClientID: "blog", AuthTime: time.Now()}, keys)
+	if err != nil {
+		t.Fatalf("error signing ID token. Err: %v", err)
+	}
+	if resp, ok := ac.introspectAccessToken(context.Background(), idToken); ok {
+		t.Errorf("expected ID token to be inactive; got %v", resp)
+	}
+}
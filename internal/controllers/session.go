@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const ssoSessionCookie = "sso_session"
+
+// ssoSession is the browser's login at the SSO server, stored in Redis under
+// the hash of the cookie value. SID is the public identifier that can be
+// shared with relying parties; the cookie value never leaves the browser.
+type ssoSession struct {
+	SID      string `json:"sid"`
+	UserID   string `json:"user_id"`
+	AuthTime int64  `json:"auth_time"`
+	Remember bool   `json:"remember"`
+	// MFA records that the login included a second factor.
+	MFA bool `json:"mfa"`
+}
+
+func sessionKey(cookieValue string) string {
+	return "sso_session:" + helper.HashToken(cookieValue)
+}
+
+// sidKey indexes sessions by sid so they can be ended without the cookie,
+// e.g. from an id_token_hint or by an administrator.
+func sidKey(sid string) string {
+	return "sso_sid:" + sid
+}
+
+// userSessionsKey holds the sids of a user's sessions so they can all be
+// ended when the account is disabled or its credentials change.
+func userSessionsKey(userID string) string {
+	return "sso_user_sessions:" + userID
+}
+
+// createSession starts an SSO session for user and sets the session cookie.
+// Without remember the cookie ends with the browser session. secondFactor
+// records that the user also passed a second factor.
+func (ac *AuthController) createSession(c *fiber.Ctx, user *models.User, remember, secondFactor bool) (*ssoSession, error) {
+	cookieValue, err := helper.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	session := &ssoSession{
+		SID:      uuid.New().String(),
+		UserID:   user.ID.String(),
+		AuthTime: time.Now().Unix(),
+		Remember: remember,
+		MFA:      secondFactor,
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	ttl := helper.SSOSessionTTL
+	if remember {
+		ttl = helper.SSOSessionRememberTTL
+	}
+	key := sessionKey(cookieValue)
+	pipe := ac.Redis.TxPipeline()
+	pipe.Set(c.Context(), key, data, ttl)
+	pipe.Set(c.Context(), sidKey(session.SID), key, ttl)
+	pipe.SAdd(c.Context(), userSessionsKey(session.UserID), session.SID)
+	pipe.Expire(c.Context(), userSessionsKey(session.UserID), helper.SSOSessionRememberTTL)
+	if _, err := pipe.Exec(c.Context()); err != nil {
+		return nil, err
+	}
+
+	cookie := &fiber.Cookie{
+		Name:     ssoSessionCookie,
+		Value:    cookieValue,
+		Path:     "/",
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	}
+	if remember {
+		cookie.Expires = time.Now().Add(ttl)
+	}
+	c.Cookie(cookie)
+	return session, nil
+}
+
+// currentSession returns the SSO session for the request's cookie together
+// with its user, or nil when there is none.
+func (ac *AuthController) currentSession(c *fiber.Ctx) (*ssoSession, *models.User) {
+	cookieValue := c.Cookies(ssoSessionCookie)
+	if cookieValue == "" {
+		return nil, nil
+	}
+	data, err := ac.Redis.Get(c.Context(), sessionKey(cookieValue)).Bytes()
+	if err != nil {
+		return nil, nil
+	}
+	var session ssoSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, nil
+	}
+	var user models.User
+	if err := ac.DB.Preload("Role").First(&user, "id = ?", session.UserID).Error; err != nil {
+		return nil, nil
+	}
+	if user.Disabled() {
+		return nil, nil
+	}
+	return &session, &user
+}
+
+// sessionClientsKey holds the set of clients that received a code during the
+// session; they are the ones to notify when it ends.
+func sessionClientsKey(sid string) string {
+	return "sso_session_clients:" + sid
+}
+
+// trackSessionClient records that client took part in the session.
+func (ac *AuthController) trackSessionClient(ctx context.Context, session *ssoSession, clientID string) error {
+	pipe := ac.Redis.TxPipeline()
+	pipe.SAdd(ctx, sessionClientsKey(session.SID), clientID)
+	pipe.Expire(ctx, sessionClientsKey(session.SID), helper.SSOSessionRememberTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// sessionClients lists the clients that took part in session sid.
+func (ac *AuthController) sessionClients(ctx context.Context, sid string) ([]string, error) {
+	return ac.Redis.SMembers(ctx, sessionClientsKey(sid)).Result()
+}
+
+// endSession destroys the SSO session sid, revokes the refresh tokens issued
+// under it and notifies participating clients over the back channel.
+func (ac *AuthController) endSession(ctx context.Context, sid string) error {
+	var session ssoSession
+	key, err := ac.Redis.Get(ctx, sidKey(sid)).Result()
+	if err == nil {
+		if data, err := ac.Redis.Get(ctx, key).Bytes(); err == nil {
+			json.Unmarshal(data, &session)
+		}
+	} else if err != redis.Nil {
+		return err
+	}
+	clientIDs, err := ac.sessionClients(ctx, sid)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{sidKey(sid), sessionClientsKey(sid)}
+	if key != "" {
+		keys = append(keys, key)
+	}
+	pipe := ac.Redis.TxPipeline()
+	pipe.Del(ctx, keys...)
+	if session.UserID != "" {
+		pipe.SRem(ctx, userSessionsKey(session.UserID), sid)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if err := ac.revokeSessionRefreshTokens(sid); err != nil {
+		return err
+	}
+	ac.notifyBackchannelLogout(clientIDs, session.UserID, sid)
+	return nil
+}
+
+// endUserSessions ends every SSO session of userID and revokes all of the
+// user's refresh tokens, including ones not tied to a session. Access tokens
+// already issued stay valid until they expire.
+func (ac *AuthController) endUserSessions(ctx context.Context, userID uuid.UUID) error {
+	return ac.endOtherUserSessions(ctx, userID, "")
+}
+
+// endOtherUserSessions is endUserSessions except for the session keepSID,
+// which stays signed in together with its refresh tokens.
+func (ac *AuthController) endOtherUserSessions(ctx context.Context, userID uuid.UUID, keepSID string) error {
+	sids, err := ac.Redis.SMembers(ctx, userSessionsKey(userID.String())).Result()
+	if err != nil {
+		return err
+	}
+	for _, sid := range sids {
+		if sid == keepSID {
+			continue
+		}
+		if err := ac.endSession(ctx, sid); err != nil {
+			return err
+		}
+	}
+	q := ac.DB.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if keepSID != "" {
+		q = q.Where("session_id <> ?", keepSID)
+	} else if err := ac.Redis.Del(ctx, userSessionsKey(userID.String())).Err(); err != nil {
+		return err
+	}
+	return q.Update("revoked_at", time.Now()).Error
+}
+
+func clearSessionCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     ssoSessionCookie,
+		Value:    "",
+		Path:     "/",
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+		Expires:  time.Unix(0, 0),
+	})
+}
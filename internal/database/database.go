@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -22,6 +23,7 @@ type Service interface {
 	Close() error
 	GetDB() *gorm.DB
 	SeedPermissionsAndRoles() error
+	SeedClients() error
 	GetRedis() *redis.Client
 }
 
@@ -52,7 +54,7 @@ func New() Service {
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
-	db.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.UserProfile{})
+	db.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.UserProfile{}, &models.Client{}, &models.RefreshToken{}, &models.LogoutDelivery{}, &models.Grant{}, &models.TOTPCredential{}, &models.RecoveryCode{})
 	dbInstance = &service{
 		db: db,
 	}
@@ -161,6 +163,7 @@ func (s *service) SeedPermissionsAndRoles() error {
 		{
 			Name:        "Administrator",
 			Permissions: []models.Permission{blogRead, blogWrite},
+			RequireMFA:  true,
 		},
 	}
 	var UserCreated models.User
@@ -171,18 +174,34 @@ func (s *service) SeedPermissionsAndRoles() error {
 	s.db.Where("email = ?", userCreds.Email).First(&UserCreated)
 
 	for _, r := range roles {
+		r.System = true
 		if err := s.db.Where(models.Role{Name: r.Name}).FirstOrCreate(&r).Error; err != nil {
 			return err
 		}
+		if !r.System {
+			if err := s.db.Model(&r).Update("system", true).Error; err != nil {
+				return err
+			}
+		}
+		// Administrators must always use a second factor, also on databases
+		// seeded before it was enforced.
+		if r.Name == "Administrator" && !r.RequireMFA {
+			if err := s.db.Model(&r).Update("require_mfa", true).Error; err != nil {
+				return err
+			}
+		}
 	}
 	var adminRole models.Role
 	s.db.Where("name=?", "Administrator").First(&adminRole)
 	if UserCreated.ID == uuid.Nil {
+		now := time.Now()
 		UserCreated = models.User{
 			Email:        userCreds.Email,
 			ID:           uuid.New(),
 			PasswordHash: helper.GeneratePassword(userCreds.Password),
 			RoleID:       adminRole.ID,
+			// The administrator's address comes from our own configuration.
+			EmailVerifiedAt: &now,
 		}
 		if err := s.db.Create(&UserCreated).Error; err != nil {
 			return err
@@ -193,3 +212,93 @@ func (s *service) SeedPermissionsAndRoles() error {
 func (s *service) GetRedis() *redis.Client {
 	return s.rdb
 }
+
+type clientSeed struct {
+	ClientID     string   `json:"client_id"`
+	Name         string   `json:"name"`
+	Secret       string   `json:"secret"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Public       bool     `json:"public"`
+	FirstParty   bool     `json:"first_party"`
+	Scopes       []string `json:"scopes"`
+	Permissions  []string `json:"permissions"`
+	Audiences    []string `json:"audiences"`
+
+	AccessTokenClaims         []string `json:"access_token_claims"`
+	RequireVerifiedEmail      bool     `json:"require_verified_email"`
+	PostLogoutRedirectURIs    []string `json:"post_logout_redirect_uris"`
+	BackchannelLogoutURI      string   `json:"backchannel_logout_uri"`
+	FrontchannelLogoutURI     string   `json:"frontchannel_logout_uri"`
+	UserInfoSignedResponseAlg string   `json:"userinfo_signed_response_alg"`
+}
+
+// SeedClients registers the OAuth2 clients listed in the JSON file pointed to
+// by CLIENTS_FILE. Existing clients are updated in place so redirect URIs and
+// secrets can be changed by editing the file and restarting.
+func (s *service) SeedClients() error {
+	path := os.Getenv("CLIENTS_FILE")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var seeds []clientSeed
+	if err := json.Unmarshal(data, &seeds); err != nil {
+		return err
+	}
+	for _, seed := range seeds {
+		for _, claim := range seed.AccessTokenClaims {
+			if !helper.IsAccessTokenClaim(claim) {
+				return fmt.Errorf("client %s: unknown access token claim %q", seed.ClientID, claim)
+			}
+		}
+		if len(seed.GrantTypes) == 0 {
+			seed.GrantTypes = []string{"authorization_code"}
+		}
+		client := models.Client{
+			ClientID:     seed.ClientID,
+			Name:         seed.Name,
+			RedirectURIs: seed.RedirectURIs,
+			GrantTypes:   seed.GrantTypes,
+			Public:       seed.Public,
+			FirstParty:   seed.FirstParty,
+			Scopes:       seed.Scopes,
+			Audiences:    seed.Audiences,
+
+			AccessTokenClaims:         seed.AccessTokenClaims,
+			RequireVerifiedEmail:      seed.RequireVerifiedEmail,
+			PostLogoutRedirectURIs:    seed.PostLogoutRedirectURIs,
+			BackchannelLogoutURI:      seed.BackchannelLogoutURI,
+			FrontchannelLogoutURI:     seed.FrontchannelLogoutURI,
+			UserInfoSignedResponseAlg: seed.UserInfoSignedResponseAlg,
+		}
+		if !seed.Public {
+			if seed.Secret == "" {
+				return fmt.Errorf("client %s is confidential but has no secret", seed.ClientID)
+			}
+			client.SecretHash = helper.GeneratePassword(seed.Secret)
+		}
+		var existing models.Client
+		s.db.Where("client_id = ?", seed.ClientID).First(&existing)
+		if existing.ID != uuid.Nil {
+			client.ID = existing.ID
+			client.CreatedAt = existing.CreatedAt
+		}
+		if err := s.db.Save(&client).Error; err != nil {
+			return err
+		}
+		var permissions []models.Permission
+		if len(seed.Permissions) > 0 {
+			if err := s.db.Where("slug IN ?", seed.Permissions).Find(&permissions).Error; err != nil {
+				return err
+			}
+		}
+		if err := s.db.Model(&client).Association("Permissions").Replace(permissions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package dto
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" form:"current_password" validate:"required"`
+	Password        string `json:"password" form:"password" validate:"required,min=8,strong_password"`
+	PasswordConfirm string `json:"password_confirm" form:"password_confirm" validate:"required,eqfield=Password"`
+}
+
+type ChangeEmailRequest struct {
+	Email           string `json:"email" form:"email" validate:"required,email"`
+	CurrentPassword string `json:"current_password" form:"current_password" validate:"required"`
+}
@@ -0,0 +1,15 @@
+package dto
+
+type AuthorizeRequest struct {
+	ResponseType string `query:"response_type"`
+	ClientID     string `query:"client_id"`
+	RedirectURI  string `query:"redirect_uri"`
+	Scope        string `query:"scope"`
+	State        string `query:"state"`
+	Nonce        string `query:"nonce"`
+	Prompt       string `query:"prompt"`
+	MaxAge       string `query:"max_age"`
+
+	CodeChallenge       string `query:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method"`
+}
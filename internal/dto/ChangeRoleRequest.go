@@ -0,0 +1,5 @@
+package dto
+
+type ChangeRoleRequest struct {
+	RoleID string `json:"role_id" form:"role_id" validate:"required,uuid"`
+}
@@ -1,6 +1,8 @@
 package dto
 
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+	Email    string `json:"email" form:"email" validate:"required,email"`
+	Password string `json:"password" form:"password" validate:"required,min=8"`
+	// Remember is the login form checkbox; browsers send "on" when checked.
+	Remember string `json:"remember" form:"remember"`
 }
@@ -0,0 +1,11 @@
+package dto
+
+type LogoutRequest struct {
+	IDTokenHint           string `query:"id_token_hint" form:"id_token_hint"`
+	PostLogoutRedirectURI string `query:"post_logout_redirect_uri" form:"post_logout_redirect_uri"`
+	ClientID              string `query:"client_id" form:"client_id"`
+	State                 string `query:"state" form:"state"`
+	// ConfirmToken is posted by the confirmation page shown when the request
+	// has no id_token_hint.
+	ConfirmToken string `form:"confirm_token"`
+}
@@ -0,0 +1,16 @@
+package dto
+
+// MFARequest carries a code from the authenticator app or a recovery code.
+type MFARequest struct {
+	Code string `json:"code" form:"code" validate:"required,max=32"`
+}
+
+// ConfirmPasswordRequest re-checks the password before sensitive changes.
+type ConfirmPasswordRequest struct {
+	CurrentPassword string `json:"current_password" form:"current_password" validate:"required"`
+}
+
+// RoleMFARequest turns the second-factor requirement of a role on or off.
+type RoleMFARequest struct {
+	Required *bool `json:"required" validate:"required"`
+}
@@ -0,0 +1,12 @@
+package dto
+
+// ForgotPasswordRequest is also used to resend verification emails.
+type ForgotPasswordRequest struct {
+	Email string `json:"email" form:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token           string `json:"token" form:"token" validate:"required"`
+	Password        string `json:"password" form:"password" validate:"required,min=8,strong_password"`
+	PasswordConfirm string `json:"password_confirm" form:"password_confirm" validate:"required,eqfield=Password"`
+}
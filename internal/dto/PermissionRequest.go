@@ -0,0 +1,6 @@
+package dto
+
+type PermissionRequest struct {
+	Name string `json:"name" form:"name" validate:"required,min=3,max=100"`
+	Slug string `json:"slug" form:"slug" validate:"required,max=100,permission_slug"`
+}
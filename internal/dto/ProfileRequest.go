@@ -0,0 +1,23 @@
+package dto
+
+// ProfileRequest is the full set of editable profile fields, as posted by the
+// account page.
+type ProfileRequest struct {
+	FullName    string `json:"full_name" form:"full_name" validate:"required,min=3,max=50"`
+	DisplayName string `json:"display_name" form:"display_name" validate:"omitempty,max=100"`
+	AvatarURL   string `json:"avatar_url" form:"avatar_url" validate:"omitempty,http_url,max=2048"`
+	Locale      string `json:"locale" form:"locale" validate:"omitempty,bcp47_language_tag,max=35"`
+	Timezone    string `json:"timezone" form:"timezone" validate:"omitempty,timezone,max=64"`
+	Phone       string `json:"phone" form:"phone" validate:"omitempty,e164"`
+}
+
+// UpdateProfileRequest is a partial update for PATCH /me/profile. Omitted
+// fields are left unchanged; an empty string clears an optional field.
+type UpdateProfileRequest struct {
+	FullName    *string `json:"full_name"`
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+	Locale      *string `json:"locale"`
+	Timezone    *string `json:"timezone"`
+	Phone       *string `json:"phone"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type RoleRequest struct {
+	Name string `json:"name" form:"name" validate:"required,min=3,max=100"`
+}
@@ -0,0 +1,33 @@
+package helper
+
+import (
+	"log"
+	"os"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+var (
+	AccessTokenTTL  = durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+	RefreshTokenTTL = durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+
+	SSOSessionTTL         = durationFromEnv("SSO_SESSION_TTL", 12*time.Hour)
+	SSOSessionRememberTTL = durationFromEnv("SSO_SESSION_REMEMBER_TTL", 30*24*time.Hour)
+
+	PasswordResetTTL     = durationFromEnv("PASSWORD_RESET_TTL", time.Hour)
+	EmailVerificationTTL = durationFromEnv("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+)
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("invalid %s %q, using %s", key, raw, fallback)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,30 @@
+package helper
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TokenDenylist records revoked access tokens by jti in Redis so every server
+// instance rejects them immediately. Entries expire together with the token.
+type TokenDenylist struct {
+	Redis *redis.Client
+}
+
+func (d *TokenDenylist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return d.Redis.Set(ctx, "revoked_jti:"+jti, 1, ttl).Err()
+}
+
+func (d *TokenDenylist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := d.Redis.Exists(ctx, "revoked_jti:"+jti).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
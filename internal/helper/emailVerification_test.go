@@ -0,0 +1,38 @@
+package helper
+
+import (
+	"sso-server/internal/models"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestEmailVerificationToken(t *testing.T) {
+	keys, err := NewKeySet(time.Hour, &SigningKey{PrivateKey: mustGenerateKey(t)})
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+	user := models.User{ID: uuid.New(), Email: "reader@example.com"}
+	tokenString, err := GenerateEmailVerificationToken(user, keys)
+	if err != nil {
+		t.Fatalf("error signing token. Err: %v", err)
+	}
+
+	sub, email, err := VerifyEmailVerificationToken(tokenString, keys)
+	if err != nil || sub != user.ID.String() || email != user.Email {
+		t.Fatalf("expected token for %s <%s>; got %s <%s>, %v", user.ID, user.Email, sub, email, err)
+	}
+	if _, err := VerifyToken(tokenString, keys); err == nil {
+		t.Errorf("expected verification token to be rejected as an access token")
+	}
+
+	access, err := signToken(jwt.MapClaims{"sub": user.ID.String(), "email": user.Email}, keys)
+	if err != nil {
+		t.Fatalf("error signing token. Err: %v", err)
+	}
+	if _, _, err := VerifyEmailVerificationToken(access, keys); err == nil {
+		t.Errorf("expected access token to be rejected as a verification token")
+	}
+}
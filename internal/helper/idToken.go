@@ -0,0 +1,55 @@
+package helper
+
+import (
+	"sso-server/internal/models"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const IDTokenTTL = time.Hour
+
+// idTokenType marks ID tokens so they are not accepted as access tokens.
+const idTokenType = "id_token+jwt"
+
+// IDTokenRequest carries the authorization request context an ID token has
+// to echo back to the relying party.
+type IDTokenRequest struct {
+	ClientID string
+	Nonce    string
+	AuthTime time.Time
+	// SessionID is the sid of the SSO session, used by logout.
+	SessionID string
+	// Claims are user claims released by the granted scope, see UserClaims.
+	Claims jwt.MapClaims
+}
+
+func GenerateIDToken(user models.User, req IDTokenRequest, keys *KeySet) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":       Issuer(),
+		"sub":       user.ID.String(),
+		"aud":       req.ClientID,
+		"azp":       req.ClientID,
+		"exp":       jwt.NewNumericDate(now.Add(IDTokenTTL)),
+		"iat":       jwt.NewNumericDate(now),
+		"auth_time": jwt.NewNumericDate(req.AuthTime),
+	}
+	for k, v := range req.Claims {
+		if _, reserved := claims[k]; !reserved {
+			claims[k] = v
+		}
+	}
+	if req.Nonce != "" {
+		claims["nonce"] = req.Nonce
+	}
+	if req.SessionID != "" {
+		claims["sid"] = req.SessionID
+	}
+	return signTokenWithType(claims, keys, idTokenType)
+}
+
+// VerifyIDToken checks the signature of an ID token issued by this server.
+func VerifyIDToken(tokenString string, keys *KeySet, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	return verifyTypedToken(tokenString, keys, idTokenType, opts...)
+}
@@ -0,0 +1,12 @@
+package helper
+
+import (
+	"os"
+	"strings"
+)
+
+// Issuer is the identifier placed in the iss claim and discovery document.
+// It is the public base URL of the server.
+func Issuer() string {
+	return strings.TrimSuffix(os.Getenv("APP_URL"), "/")
+}
@@ -0,0 +1,108 @@
+package helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// JWK is the public half of a signing key as published in the JWKS document.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK describes publicKey as a JWK for alg. The kid is the RFC 7638
+// thumbprint of the key.
+func PublicJWK(publicKey crypto.PublicKey, alg string) (JWK, error) {
+	jwk, err := thumbprintMembers(publicKey)
+	if err != nil {
+		return JWK{}, err
+	}
+	jwk.Use = "sig"
+	jwk.Alg = alg
+	jwk.Kid = KeyID(publicKey)
+	return jwk, nil
+}
+
+// thumbprintMembers fills in only the required members of the JWK, which are
+// exactly the ones RFC 7638 hashes.
+func thumbprintMembers(publicKey crypto.PublicKey) (JWK, error) {
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}, nil
+	}
+	return JWK{}, fmt.Errorf("unsupported public key type %T", publicKey)
+}
+
+// KeyID derives a stable kid from the RFC 7638 JWK thumbprint of the key, so
+// the same key always gets the same kid across restarts and instances.
+func KeyID(publicKey crypto.PublicKey) string {
+	jwk, err := thumbprintMembers(publicKey)
+	if err != nil {
+		return ""
+	}
+	// encoding/json writes struct fields in declaration order, so each shape
+	// lists its members lexicographically as the RFC requires.
+	var thumbprint []byte
+	switch jwk.Kty {
+	case "RSA":
+		thumbprint, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+	case "EC":
+		thumbprint, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y})
+	case "OKP":
+		thumbprint, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X})
+	}
+	sum := sha256.Sum256(thumbprint)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
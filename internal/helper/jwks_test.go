@@ -0,0 +1,33 @@
+package helper
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+)
+
+// Example key and thumbprint from RFC 7638 section 3.1.
+const (
+	rfcModulus    = "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"
+	rfcThumbprint = "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+)
+
+func TestKeyID(t *testing.T) {
+	n, err := base64.RawURLEncoding.DecodeString(rfcModulus)
+	if err != nil {
+		t.Fatalf("error decoding modulus. Err: %v", err)
+	}
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+
+	if kid := KeyID(key); kid != rfcThumbprint {
+		t.Errorf("expected kid %s; got %s", rfcThumbprint, kid)
+	}
+	jwk, err := PublicJWK(key, "RS256")
+	if err != nil {
+		t.Fatalf("error building JWK. Err: %v", err)
+	}
+	if jwk.E != "AQAB" || jwk.N != rfcModulus || jwk.Kid != rfcThumbprint {
+		t.Errorf("unexpected JWK %+v", jwk)
+	}
+}
@@ -0,0 +1,242 @@
+package helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported JWS algorithms. Each key signs with exactly one of them.
+const (
+	AlgRS256 = "RS256"
+	AlgPS256 = "PS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is one entry of a KeySet. Keys without a PrivateKey are only
+// used to verify tokens signed before a rotation.
+type SigningKey struct {
+	ID string
+	// Algorithm defaults to RS256 for RSA keys, ES256 for P-256 keys and
+	// EdDSA for Ed25519 keys.
+	Algorithm  string
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	// NotBefore schedules when a key with a private half takes over signing.
+	NotBefore time.Time
+	// NotAfter retires the key; tokens carrying its kid stop verifying.
+	NotAfter time.Time
+}
+
+// KeySet holds the current signing key together with the keys that are still
+// accepted for verification. Rotation is driven by the clock: once a newer
+// key's NotBefore passes it becomes the signing key, and the key it replaced
+// keeps verifying for the overlap window so tokens issued just before the
+// switch stay valid until they expire.
+type KeySet struct {
+	keys    []*SigningKey
+	overlap time.Duration
+}
+
+func NewKeySet(overlap time.Duration, keys ...*SigningKey) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("key set needs at least one key")
+	}
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if k.PublicKey == nil {
+			if k.PrivateKey == nil {
+				return nil, fmt.Errorf("key has neither a private nor a public key")
+			}
+			k.PublicKey = k.PrivateKey.Public()
+		}
+		// A mismatched pair would publish a key that cannot verify the
+		// tokens signed with the private half.
+		if k.PrivateKey != nil {
+			pub, ok := k.PrivateKey.Public().(interface{ Equal(crypto.PublicKey) bool })
+			if !ok || !pub.Equal(k.PublicKey) {
+				return nil, fmt.Errorf("public key does not belong to the private key")
+			}
+		}
+		if err := k.checkAlgorithm(); err != nil {
+			return nil, err
+		}
+		if k.ID == "" {
+			k.ID = KeyID(k.PublicKey)
+		}
+		if seen[k.ID] {
+			return nil, fmt.Errorf("duplicate key id %s", k.ID)
+		}
+		seen[k.ID] = true
+	}
+	sorted := slices.Clone(keys)
+	slices.SortStableFunc(sorted, func(a, b *SigningKey) int {
+		return a.NotBefore.Compare(b.NotBefore)
+	})
+	return &KeySet{keys: sorted, overlap: overlap}, nil
+}
+
+// SigningKey returns the key new tokens are signed with: the most recently
+// scheduled key with a private half whose NotBefore has passed.
+func (ks *KeySet) SigningKey() (*SigningKey, error) {
+	now := time.Now()
+	var current *SigningKey
+	for _, k := range ks.keys {
+		if k.PrivateKey == nil || k.NotBefore.After(now) || ks.retired(k, now) {
+			continue
+		}
+		current = k
+	}
+	if current == nil {
+		return nil, fmt.Errorf("no signing key is active")
+	}
+	return current, nil
+}
+
+// VerificationKey looks a key up by kid. Retired keys are not returned.
+func (ks *KeySet) VerificationKey(kid string) (*SigningKey, error) {
+	now := time.Now()
+	for _, k := range ks.keys {
+		if k.ID == kid && !ks.retired(k, now) {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// PublishedKeys lists every key that is not retired, including ones scheduled
+// for the future, so relying parties can cache them ahead of the switch.
+func (ks *KeySet) PublishedKeys() []*SigningKey {
+	now := time.Now()
+	published := make([]*SigningKey, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		if !ks.retired(k, now) {
+			published = append(published, k)
+		}
+	}
+	return published
+}
+
+// retired reports whether k is past its explicit NotAfter, or was replaced
+// as signing key more than the overlap window ago.
+func (ks *KeySet) retired(k *SigningKey, now time.Time) bool {
+	if !k.NotAfter.IsZero() && !now.Before(k.NotAfter) {
+		return true
+	}
+	if k.PrivateKey == nil {
+		return false
+	}
+	for _, next := range ks.keys {
+		if next == k || next.PrivateKey == nil || !next.NotBefore.After(k.NotBefore) {
+			continue
+		}
+		if !next.NotAfter.IsZero() && !now.Before(next.NotAfter) {
+			continue
+		}
+		if !now.Before(next.NotBefore.Add(ks.overlap)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Algorithms lists the distinct algorithms of the published keys, for the
+// discovery document.
+func (ks *KeySet) Algorithms() []string {
+	var algs []string
+	for _, k := range ks.PublishedKeys() {
+		if !slices.Contains(algs, k.Algorithm) {
+			algs = append(algs, k.Algorithm)
+		}
+	}
+	return algs
+}
+
+// checkAlgorithm fills in the default algorithm for the key type and rejects
+// combinations jwt cannot sign or verify.
+func (k *SigningKey) checkAlgorithm() error {
+	switch pub := k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if k.Algorithm == "" {
+			k.Algorithm = AlgRS256
+		}
+		if k.Algorithm != AlgRS256 && k.Algorithm != AlgPS256 {
+			return fmt.Errorf("algorithm %s cannot be used with an RSA key", k.Algorithm)
+		}
+	case *ecdsa.PublicKey:
+		if k.Algorithm == "" {
+			k.Algorithm = AlgES256
+		}
+		if k.Algorithm != AlgES256 || pub.Curve != elliptic.P256() {
+			return fmt.Errorf("algorithm %s cannot be used with a %s key", k.Algorithm, pub.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		if k.Algorithm == "" {
+			k.Algorithm = AlgEdDSA
+		}
+		if k.Algorithm != AlgEdDSA {
+			return fmt.Errorf("algorithm %s cannot be used with an Ed25519 key", k.Algorithm)
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", k.PublicKey)
+	}
+	return nil
+}
+
+func (k *SigningKey) signingMethod() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// ParsePrivateKeyPEM reads an RSA (PKCS#1 or PKCS#8), EC or Ed25519 private
+// key.
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// ParsePublicKeyPEM reads a PKIX or PKCS#1 public key, or the public key of
+// a certificate.
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported public key: %w", err)
+	}
+	return cert.PublicKey, nil
+}
@@ -0,0 +1,197 @@
+package helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"sso-server/internal/models"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func mustGenerateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key. Err: %v", err)
+	}
+	return key
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey, newKey := mustGenerateKey(t), mustGenerateKey(t)
+	now := time.Now()
+
+	old := &SigningKey{PrivateKey: oldKey, NotBefore: now.Add(-48 * time.Hour)}
+	next := &SigningKey{PrivateKey: newKey, NotBefore: now.Add(-time.Hour)}
+	keys, err := NewKeySet(2*time.Hour, next, old)
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+
+	signing, err := keys.SigningKey()
+	if err != nil || signing != next {
+		t.Fatalf("expected newest scheduled key to sign; got %v, %v", signing, err)
+	}
+	if _, err := keys.VerificationKey(old.ID); err != nil {
+		t.Errorf("expected replaced key to verify within the overlap window; got %v", err)
+	}
+	if n := len(keys.PublishedKeys()); n != 2 {
+		t.Errorf("expected 2 published keys; got %d", n)
+	}
+
+	short, err := NewKeySet(30*time.Minute, &SigningKey{PrivateKey: oldKey, NotBefore: old.NotBefore}, &SigningKey{PrivateKey: newKey, NotBefore: next.NotBefore})
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+	if _, err := short.VerificationKey(KeyID(&oldKey.PublicKey)); err == nil {
+		t.Errorf("expected replaced key to be retired after the overlap window")
+	}
+}
+
+func TestKeySetScheduledKeyNotYetSigning(t *testing.T) {
+	current, upcoming := mustGenerateKey(t), mustGenerateKey(t)
+	keys, err := NewKeySet(time.Hour,
+		&SigningKey{PrivateKey: current},
+		&SigningKey{PrivateKey: upcoming, NotBefore: time.Now().Add(time.Hour)},
+	)
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+	signing, err := keys.SigningKey()
+	if err != nil || signing.PrivateKey != current {
+		t.Fatalf("expected current key to keep signing until the scheduled switch")
+	}
+	if n := len(keys.PublishedKeys()); n != 2 {
+		t.Errorf("expected upcoming key to be published early; got %d keys", n)
+	}
+}
+
+func TestVerifyTokenSelectsKeyByKid(t *testing.T) {
+	oldKey, newKey := mustGenerateKey(t), mustGenerateKey(t)
+	before, err := NewKeySet(time.Hour, &SigningKey{PrivateKey: oldKey})
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+	tokenString, err := signToken(accessClaims("someone"), before)
+	if err != nil {
+		t.Fatalf("error signing token. Err: %v", err)
+	}
+
+	after, err := NewKeySet(time.Hour,
+		&SigningKey{PublicKey: &oldKey.PublicKey},
+		&SigningKey{PrivateKey: newKey},
+	)
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+	if _, err := VerifyToken(tokenString, after); err != nil {
+		t.Errorf("expected token signed before rotation to verify; got %v", err)
+	}
+
+	unrelated, err := NewKeySet(time.Hour, &SigningKey{PrivateKey: newKey})
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+	if _, err := VerifyToken(tokenString, unrelated); err == nil {
+		t.Errorf("expected token with unknown kid to be rejected")
+	}
+}
+
+func TestSignAndVerifyPerAlgorithm(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key. Err: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key. Err: %v", err)
+	}
+	cases := []struct {
+		key *SigningKey
+		alg string
+	}{
+		{&SigningKey{PrivateKey: mustGenerateKey(t), Algorithm: AlgPS256}, AlgPS256},
+		{&SigningKey{PrivateKey: ecKey}, AlgES256},
+		{&SigningKey{PrivateKey: edKey}, AlgEdDSA},
+	}
+	for _, tc := range cases {
+		keys, err := NewKeySet(time.Hour, tc.key)
+		if err != nil {
+			t.Fatalf("%s: error building key set. Err: %v", tc.alg, err)
+		}
+		tokenString, err := signToken(accessClaims("someone"), keys)
+		if err != nil {
+			t.Fatalf("%s: error signing token. Err: %v", tc.alg, err)
+		}
+		token, err := VerifyToken(tokenString, keys)
+		if err != nil {
+			t.Fatalf("%s: error verifying token. Err: %v", tc.alg, err)
+		}
+		if token.Method.Alg() != tc.alg {
+			t.Errorf("expected alg %s; got %s", tc.alg, token.Method.Alg())
+		}
+		if algs := keys.Algorithms(); len(algs) != 1 || algs[0] != tc.alg {
+			t.Errorf("expected advertised algorithms [%s]; got %v", tc.alg, algs)
+		}
+	}
+
+	if _, err := NewKeySet(time.Hour, &SigningKey{PrivateKey: ecKey, Algorithm: AlgRS256}); err == nil {
+		t.Errorf("expected RS256 on an EC key to be rejected")
+	}
+}
+
+// accessClaims are the claims VerifyToken requires of every access token.
+func accessClaims(sub string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": sub,
+		"jti": "test-" + sub,
+		"exp": jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+}
+
+func TestVerifyTokenRejectsNonAccessTokens(t *testing.T) {
+	keys, err := NewKeySet(time.Hour, &SigningKey{PrivateKey: mustGenerateKey(t)})
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+	idToken, err := GenerateIDToken(models.User{ID: uuid.New()}, IDTokenRequest{ClientID: "blog", AuthTime: time.Now()}, keys)
+	if err != nil {
+		t.Fatalf("error signing ID token. Err: %v", err)
+	}
+	if _, err := VerifyToken(idToken, keys); err == nil {
+		t.Errorf("expected ID token to be rejected as an access token")
+	}
+	if _, err := VerifyIDToken(idToken, keys); err != nil {
+		t.Errorf("expected ID token to verify as an ID token; got %v", err)
+	}
+
+	noJTI := accessClaims("someone")
+	delete(noJTI, "jti")
+	withAud := accessClaims("someone")
+	withAud["aud"] = "blog"
+	for name, claims := range map[string]jwt.MapClaims{"no jti": noJTI, "aud": withAud} {
+		tokenString, err := signToken(claims, keys)
+		if err != nil {
+			t.Fatalf("error signing token. Err: %v", err)
+		}
+		if _, err := VerifyToken(tokenString, keys); err == nil {
+			t.Errorf("%s: expected token to be rejected", name)
+		}
+	}
+}
+
+func TestNewKeySetRejectsMismatchedPair(t *testing.T) {
+	key, other := mustGenerateKey(t), mustGenerateKey(t)
+	if _, err := NewKeySet(time.Hour, &SigningKey{PrivateKey: key, PublicKey: &other.PublicKey}); err == nil {
+		t.Errorf("expected a public key from another pair to be rejected")
+	}
+	if _, err := NewKeySet(time.Hour, &SigningKey{PrivateKey: key, PublicKey: &key.PublicKey}); err != nil {
+		t.Errorf("expected a matching pair to be accepted; got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package helper
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// GenerateLogoutToken builds an OIDC Back-Channel Logout token for clientID.
+// At least one of sub and sid must be set.
+func GenerateLogoutToken(clientID, sub, sid string, keys *KeySet) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":    Issuer(),
+		"aud":    clientID,
+		"iat":    jwt.NewNumericDate(now),
+		"exp":    jwt.NewNumericDate(now.Add(2 * time.Minute)),
+		"jti":    uuid.New().String(),
+		"events": map[string]any{backchannelLogoutEvent: map[string]any{}},
+	}
+	if sub != "" {
+		claims["sub"] = sub
+	}
+	if sid != "" {
+		claims["sid"] = sid
+	}
+	return signTokenWithType(claims, keys, "logout+jwt")
+}
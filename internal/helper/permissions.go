@@ -0,0 +1,36 @@
+package helper
+
+import (
+	"slices"
+	"sso-server/internal/models"
+	"strings"
+)
+
+// PermissionAudience returns the service a permission slug belongs to, the
+// part before the colon: "blog" for "blog:write".
+func PermissionAudience(slug string) string {
+	audience, _, _ := strings.Cut(slug, ":")
+	return audience
+}
+
+// EffectivePermissions returns the slugs from permissions that may go into
+// an access token for the given scope. A permission is released when its
+// audience is one the client may call and the scope asks for either the
+// whole audience ("blog") or the permission itself ("blog:write").
+func EffectivePermissions(permissions []models.Permission, scope string, audiences []string) []string {
+	scopes := strings.Fields(scope)
+	slugs := []string{}
+	for _, p := range permissions {
+		audience := PermissionAudience(p.Slug)
+		if !slices.Contains(audiences, audience) {
+			continue
+		}
+		if !slices.Contains(scopes, audience) && !slices.Contains(scopes, p.Slug) {
+			continue
+		}
+		if !slices.Contains(slugs, p.Slug) {
+			slugs = append(slugs, p.Slug)
+		}
+	}
+	return slugs
+}
@@ -0,0 +1,34 @@
+package helper
+
+import (
+	"slices"
+	"sso-server/internal/models"
+	"testing"
+)
+
+func TestEffectivePermissions(t *testing.T) {
+	perms := []models.Permission{
+		{Slug: "blog:read"},
+		{Slug: "blog:write"},
+		{Slug: "library:read"},
+	}
+	tests := []struct {
+		name      string
+		scope     string
+		audiences []string
+		want      []string
+	}{
+		{"whole audience", "openid blog", []string{"blog", "library"}, []string{"blog:read", "blog:write"}},
+		{"single permission", "blog:read library", []string{"blog", "library"}, []string{"blog:read", "library:read"}},
+		{"audience not allowed for client", "blog library", []string{"blog"}, []string{"blog:read", "blog:write"}},
+		{"no matching scope", "openid profile", []string{"blog"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EffectivePermissions(perms, tt.scope, tt.audiences)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("EffectivePermissions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package helper
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+)
+
+const (
+	PKCEMethodPlain = "plain"
+	PKCEMethodS256  = "S256"
+)
+
+// RFC 7636 section 4.1: 43-128 characters from the unreserved set. The same
+// shape applies to challenges, since an S256 challenge is always 43 characters.
+var pkceValuePattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// NormalizeCodeChallengeMethod validates an incoming code_challenge and
+// returns the effective method, defaulting to plain as RFC 7636 requires.
+func NormalizeCodeChallengeMethod(challenge, method string, allowPlain bool) (string, error) {
+	if method == "" {
+		method = PKCEMethodPlain
+	}
+	switch method {
+	case PKCEMethodS256:
+	case PKCEMethodPlain:
+		if !allowPlain {
+			return "", fmt.Errorf("code_challenge_method plain is not allowed")
+		}
+	default:
+		return "", fmt.Errorf("unsupported code_challenge_method %q", method)
+	}
+	if !pkceValuePattern.MatchString(challenge) {
+		return "", fmt.Errorf("malformed code_challenge")
+	}
+	return method, nil
+}
+
+// VerifyCodeVerifier checks a code_verifier against the challenge stored with
+// the authorization code.
+func VerifyCodeVerifier(verifier, challenge, method string) bool {
+	if !pkceValuePattern.MatchString(verifier) {
+		return false
+	}
+	var computed string
+	switch method {
+	case PKCEMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	case PKCEMethodPlain:
+		computed = verifier
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
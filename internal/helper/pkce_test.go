@@ -0,0 +1,39 @@
+package helper
+
+import "testing"
+
+// Test vector from RFC 7636 Appendix B.
+const (
+	rfcVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfcChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	if !VerifyCodeVerifier(rfcVerifier, rfcChallenge, PKCEMethodS256) {
+		t.Errorf("expected RFC 7636 S256 vector to verify")
+	}
+	if VerifyCodeVerifier(rfcVerifier+"x", rfcChallenge, PKCEMethodS256) {
+		t.Errorf("expected modified verifier to fail")
+	}
+	if !VerifyCodeVerifier(rfcVerifier, rfcVerifier, PKCEMethodPlain) {
+		t.Errorf("expected plain verifier to match itself")
+	}
+	if VerifyCodeVerifier("short", "short", PKCEMethodPlain) {
+		t.Errorf("expected verifier shorter than 43 characters to fail")
+	}
+}
+
+func TestNormalizeCodeChallengeMethod(t *testing.T) {
+	if method, err := NormalizeCodeChallengeMethod(rfcChallenge, "", true); err != nil || method != PKCEMethodPlain {
+		t.Errorf("expected empty method to default to plain; got %q, %v", method, err)
+	}
+	if _, err := NormalizeCodeChallengeMethod(rfcChallenge, PKCEMethodPlain, false); err == nil {
+		t.Errorf("expected plain to be rejected when disallowed")
+	}
+	if _, err := NormalizeCodeChallengeMethod(rfcChallenge, "S512", true); err == nil {
+		t.Errorf("expected unknown method to be rejected")
+	}
+	if _, err := NormalizeCodeChallengeMethod("abc", PKCEMethodS256, true); err == nil {
+		t.Errorf("expected malformed challenge to be rejected")
+	}
+}
@@ -1,8 +1,9 @@
 package helper
 
 import (
-	"crypto/rsa"
+	"errors"
 	"fmt"
+	"slices"
 	"sso-server/internal/models"
 	"time"
 
@@ -11,31 +12,182 @@ import (
 	"github.com/google/uuid"
 )
 
-func GenerateToken(user models.User, privateKey *rsa.PrivateKey) (string, error) {
+// TokenGrant describes which client a token is issued to and what it was
+// granted.
+type TokenGrant struct {
+	ClientID string
+	Scope    string
+	// AuthTime is when the user last actively authenticated.
+	AuthTime time.Time
+	// SessionID is the sid of the SSO session the token was issued under.
+	SessionID string
+	// Permissions are the permission slugs released for Scope, see
+	// EffectivePermissions.
+	Permissions []string
+	// Claims selects the optional claims to include. Nil means
+	// DefaultAccessTokenClaims.
+	Claims []string
+}
+
+// Optional access token claims. Clients pick a subset with
+// access_token_claims; sub, user_id and the registered claims are always set.
+const (
+	ClaimEmail       = "email"
+	ClaimRole        = "role"
+	ClaimPermissions = "permissions"
+)
+
+var DefaultAccessTokenClaims = []string{ClaimEmail, ClaimRole, ClaimPermissions}
+
+// IsAccessTokenClaim reports whether name is an optional access token claim.
+func IsAccessTokenClaim(name string) bool {
+	return slices.Contains(DefaultAccessTokenClaims, name)
+}
+
+func GenerateToken(user models.User, grant TokenGrant, keys *KeySet) (string, error) {
 	claims := jwt.MapClaims{
+		"iss":     Issuer(),
 		"sub":     user.ID.String(),
 		"jti":     uuid.New().String(),
-		"exp":     jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
+		"exp":     jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 		"iat":     jwt.NewNumericDate(time.Now()),
-		"email":   user.Email,
-		"role":    user.Role.Name,
 		"user_id": user.ID.String(),
 	}
+	include := grant.Claims
+	if include == nil {
+		include = DefaultAccessTokenClaims
+	}
+	if slices.Contains(include, ClaimEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified()
+	}
+	if slices.Contains(include, ClaimRole) {
+		claims["role"] = user.Role.Name
+	}
+	if slices.Contains(include, ClaimPermissions) {
+		permissions := grant.Permissions
+		if permissions == nil {
+			permissions = []string{}
+		}
+		claims["permissions"] = permissions
+	}
+	if grant.ClientID != "" {
+		claims["client_id"] = grant.ClientID
+	}
+	if grant.Scope != "" {
+		claims["scope"] = grant.Scope
+	}
+	if !grant.AuthTime.IsZero() {
+		claims["auth_time"] = jwt.NewNumericDate(grant.AuthTime)
+	}
+	if grant.SessionID != "" {
+		claims["sid"] = grant.SessionID
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	return token.SignedString(privateKey)
+	return signToken(claims, keys)
 }
 
-func GetUserFromContext(c *fiber.Ctx) (models.User, error) {
-	var user models.User
+// signToken signs claims with the key set's current signing key, stamping its
+// kid so verifiers can pick the right key after a rotation.
+func signToken(claims jwt.MapClaims, keys *KeySet) (string, error) {
+	return signTokenWithType(claims, keys, "")
+}
+
+// signTokenWithType is signToken with an explicit typ header, for tokens that
+// must not be mistaken for access or ID tokens.
+func signTokenWithType(claims jwt.MapClaims, keys *KeySet, typ string) (string, error) {
+	key, err := keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.signingMethod(), claims)
+	token.Header["kid"] = key.ID
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(key.PrivateKey)
+}
+
+const SubjectTypeClient = "client"
+
+var ErrClientToken = errors.New("token was issued to a client, not a user")
+
+// GenerateClientToken issues a client_credentials token. The subject is the
+// client itself and the sub_type claim marks it as a service token.
+func GenerateClientToken(client models.Client, scope string, keys *KeySet) (string, error) {
+	permissions := make([]string, 0, len(client.Permissions))
+	for _, p := range client.Permissions {
+		permissions = append(permissions, p.Slug)
+	}
+	claims := jwt.MapClaims{
+		"iss":         Issuer(),
+		"sub":         client.ClientID,
+		"sub_type":    SubjectTypeClient,
+		"client_id":   client.ClientID,
+		"jti":         uuid.New().String(),
+		"exp":         jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
+		"iat":         jwt.NewNumericDate(time.Now()),
+		"permissions": permissions,
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	return signToken(claims, keys)
+}
+
+func IsClientToken(claims jwt.MapClaims) bool {
+	subType, _ := claims["sub_type"].(string)
+	return subType == SubjectTypeClient
+}
+
+func claimsFromContext(c *fiber.Ctx) (jwt.MapClaims, error) {
 	token, ok := c.Locals("user").(*jwt.Token)
 	if !ok || token == nil {
-		return user, fmt.Errorf("token not found in context")
+		return nil, fmt.Errorf("token not found in context")
 	}
-
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return user, fmt.Errorf("invalid token claims")
+		return nil, fmt.Errorf("invalid token claims")
+	}
+	return claims, nil
+}
+
+// GetClientIDFromContext returns the client a client_credentials token was
+// issued to. It fails for user tokens.
+func GetClientIDFromContext(c *fiber.Ctx) (string, error) {
+	claims, err := claimsFromContext(c)
+	if err != nil {
+		return "", err
+	}
+	if !IsClientToken(claims) {
+		return "", fmt.Errorf("token was issued to a user, not a client")
+	}
+	clientID, _ := claims["sub"].(string)
+	return clientID, nil
+}
+
+// GetSessionIDFromContext returns the sid of the SSO session the verified
+// token was issued under, or "" when it has none.
+func GetSessionIDFromContext(c *fiber.Ctx) string {
+	claims, err := claimsFromContext(c)
+	if err != nil {
+		return ""
+	}
+	sid, _ := claims["sid"].(string)
+	return sid
+}
+
+// GetUserFromContext returns the user behind the verified token. Service
+// tokens from the client_credentials grant have no user and yield
+// ErrClientToken.
+func GetUserFromContext(c *fiber.Ctx) (models.User, error) {
+	var user models.User
+	claims, err := claimsFromContext(c)
+	if err != nil {
+		return user, err
+	}
+	if IsClientToken(claims) {
+		return user, ErrClientToken
 	}
 	userIDStr, ok := claims["user_id"].(string)
 	if !ok {
@@ -57,12 +209,54 @@ func GetUserFromContext(c *fiber.Ctx) (models.User, error) {
 
 	return user, nil
 }
-func VerifyToken(tokenString string, publicKey *rsa.PublicKey) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+// VerifyToken verifies an access token. The signature is checked against the
+// key named by the token's kid header, or the current signing key when there
+// is none, and the token's alg must match the algorithm configured for that
+// key. Tokens with an explicit typ, such as ID, logout or email verification
+// tokens, are rejected so they cannot be used for authentication, and so are
+// tokens addressed to a client with aud. Access tokens always carry exp and a
+// jti that revocation can refer to.
+func VerifyToken(tokenString string, keys *KeySet, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	opts = append(opts, jwt.WithExpirationRequired())
+	token, err := verifyTypedToken(tokenString, keys, "", opts...)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+	if jti, _ := claims["jti"].(string); jti == "" {
+		return nil, fmt.Errorf("token has no jti")
+	}
+	if _, ok := claims["aud"]; ok {
+		return nil, fmt.Errorf("token is addressed to a client, not a resource server")
+	}
+	return token, nil
+}
+
+// verifyTypedToken is VerifyToken for tokens signed with signTokenWithType.
+// An empty typ accepts plain JWTs only.
+func verifyTypedToken(tokenString string, keys *KeySet, typ string, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		got, _ := token.Header["typ"].(string)
+		if typ == "" && got != "" && got != "JWT" || typ != "" && got != typ {
+			return nil, fmt.Errorf("unexpected token type %q", got)
+		}
+		var key *SigningKey
+		var err error
+		if kid, _ := token.Header["kid"].(string); kid != "" {
+			key, err = keys.VerificationKey(kid)
+		} else {
+			key, err = keys.SigningKey()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return publicKey, nil
-	})
+		return key.PublicKey, nil
+	}, opts...)
 }
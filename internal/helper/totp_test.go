@@ -0,0 +1,77 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B vectors for SHA-1, truncated to six digits.
+func TestTOTPCodeRFCVectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		got, err := TOTPCode(secret, TOTPCounter(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("error computing code. Err: %v", err)
+		}
+		if got != want {
+			t.Errorf("TOTPCode at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("error generating secret. Err: %v", err)
+	}
+	now := time.Now()
+	previous, _ := TOTPCode(secret, TOTPCounter(now)-1)
+	if counter, ok := ValidateTOTP(secret, previous, now); !ok || counter != TOTPCounter(now)-1 {
+		t.Errorf("expected code from the previous period to be accepted")
+	}
+	stale, _ := TOTPCode(secret, TOTPCounter(now)-3)
+	if _, ok := ValidateTOTP(secret, stale, now); ok {
+		t.Errorf("expected code from three periods ago to be rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil || len(codes) != 10 {
+		t.Fatalf("expected 10 codes; got %d, %v", len(codes), err)
+	}
+	if got := NormalizeRecoveryCode(" " + strings.ToUpper(strings.ReplaceAll(codes[0], "-", "")) + " "); got != codes[0] {
+		t.Errorf("NormalizeRecoveryCode = %q, want %q", got, codes[0])
+	}
+}
+
+func TestTOTPQRCode(t *testing.T) {
+	uri := TOTPProvisioningURI("JBSWY3DPEHPK3PXP", "user@example.com", "sso.example.com")
+	qr, err := TOTPQRCode(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, ok := strings.CutPrefix(qr, "data:image/png;base64,")
+	if !ok {
+		t.Fatalf("not a PNG data URI: %.40s", qr)
+	}
+	png, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Fatal("missing PNG signature")
+	}
+}
@@ -0,0 +1,80 @@
+package helper
+
+import (
+	"sso-server/internal/models"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ScopeClaims maps each OIDC scope to the user claims it releases in ID
+// tokens and UserInfo responses.
+var ScopeClaims = map[string][]string{
+	"profile": {"name", "nickname", "picture", "locale", "zoneinfo", "updated_at"},
+	"email":   {"email", "email_verified"},
+	"phone":   {"phone_number", "phone_number_verified"},
+}
+
+// UserClaims returns the standard OIDC claims for user, limited to those
+// released by the granted scope. Profile fields the user has not filled in,
+// and updated_at for users without a profile, are left out.
+func UserClaims(user models.User, profile models.UserProfile, scope string) jwt.MapClaims {
+	values := map[string]interface{}{
+		"email":          user.Email,
+		"email_verified": user.EmailVerified(),
+	}
+	if !profile.UpdatedAt.IsZero() {
+		values["updated_at"] = profile.UpdatedAt.Unix()
+	}
+	optional := map[string]string{
+		"name":         profile.FullName,
+		"nickname":     profile.DisplayName,
+		"picture":      profile.AvatarURL,
+		"locale":       profile.Locale,
+		"zoneinfo":     profile.Timezone,
+		"phone_number": profile.Phone,
+	}
+	for name, value := range optional {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	if profile.Phone != "" {
+		values["phone_number_verified"] = false
+	}
+	claims := jwt.MapClaims{
+		"sub": user.ID.String(),
+	}
+	for _, s := range strings.Fields(scope) {
+		for _, name := range ScopeClaims[s] {
+			if value, ok := values[name]; ok {
+				claims[name] = value
+			}
+		}
+	}
+	return claims
+}
+
+// userInfoType marks signed UserInfo responses so they are not accepted as
+// access tokens.
+const userInfoType = "userinfo+jwt"
+
+// userInfoTokenTTL only needs to cover the client reading the response.
+const userInfoTokenTTL = 5 * time.Minute
+
+// GenerateUserInfoToken signs a UserInfo response for clients that registered
+// for signed responses.
+func GenerateUserInfoToken(claims jwt.MapClaims, clientID string, keys *KeySet) (string, error) {
+	now := time.Now()
+	signed := jwt.MapClaims{
+		"iss": Issuer(),
+		"aud": clientID,
+		"iat": jwt.NewNumericDate(now),
+		"exp": jwt.NewNumericDate(now.Add(userInfoTokenTTL)),
+	}
+	for k, v := range claims {
+		signed[k] = v
+	}
+	return signTokenWithType(signed, keys, userInfoType)
+}
@@ -0,0 +1,53 @@
+package helper
+
+import (
+	"sso-server/internal/models"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestUserClaimsOmitsMissingProfile(t *testing.T) {
+	user := models.User{ID: uuid.New(), Email: "user@example.com"}
+	claims := UserClaims(user, models.UserProfile{}, "openid profile email")
+	for _, name := range []string{"name", "updated_at", "nickname"} {
+		if _, ok := claims[name]; ok {
+			t.Errorf("%s = %v, want it left out", name, claims[name])
+		}
+	}
+	if claims["email"] != "user@example.com" {
+		t.Errorf("email = %v", claims["email"])
+	}
+
+	updated := time.Unix(1700000000, 0)
+	claims = UserClaims(user, models.UserProfile{FullName: "Jane Doe", UpdatedAt: updated}, "profile")
+	if claims["name"] != "Jane Doe" || claims["updated_at"] != updated.Unix() {
+		t.Errorf("claims = %v", claims)
+	}
+	if _, ok := claims["email"]; ok {
+		t.Error("email released without the email scope")
+	}
+}
+
+func TestUserInfoTokenIsNotAnAccessToken(t *testing.T) {
+	keys, err := NewKeySet(time.Hour, &SigningKey{PrivateKey: mustGenerateKey(t)})
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+	tokenString, err := GenerateUserInfoToken(jwt.MapClaims{"sub": uuid.NewString()}, "blog", keys)
+	if err != nil {
+		t.Fatalf("error signing token. Err: %v", err)
+	}
+	if _, err := VerifyToken(tokenString, keys); err == nil {
+		t.Errorf("expected signed UserInfo response to be rejected as an access token")
+	}
+	token, err := verifyTypedToken(tokenString, keys, userInfoType)
+	if err != nil {
+		t.Fatalf("error verifying token. Err: %v", err)
+	}
+	if exp, err := token.Claims.GetExpirationTime(); err != nil || exp == nil {
+		t.Errorf("expected an exp claim; got %v, %v", exp, err)
+	}
+}
@@ -17,6 +17,20 @@ func GetCustomMessage(fe validator.FieldError) string {
 		return "Too short (minimum " + fe.Param() + " characters)"
 	case "max":
 		return "Too long (maximum " + fe.Param() + " characters)"
+	case "strong_password":
+		return "Must contain upper and lower case letters, a number and a symbol"
+	case "eqfield":
+		return "Does not match " + fe.Param()
+	case "http_url":
+		return "Must be an http or https URL"
+	case "bcp47_language_tag":
+		return "Must be a language tag such as en-US"
+	case "timezone":
+		return "Must be a time zone such as Asia/Jakarta"
+	case "e164":
+		return "Must be a phone number in international format, e.g. +6281234567890"
+	case "permission_slug":
+		return "Must look like service:action, e.g. blog:write"
 	}
 	return "Invalid value"
 }
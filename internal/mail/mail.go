@@ -0,0 +1,123 @@
+// Package mail delivers transactional email such as password reset links.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// FromEnv builds the mailer selected by MAIL_DRIVER: "smtp", "file" or
+// "stdout" (for development). There is no default: the messages carry
+// password reset and verification links, which must not end up in the server
+// log because the variable was forgotten.
+func FromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return nil, fmt.Errorf("MAIL_DRIVER=smtp requires SMTP_ADDR")
+		}
+		return &SMTPMailer{
+			Addr:     addr,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	case "file":
+		path := os.Getenv("MAIL_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("MAIL_DRIVER=file requires MAIL_FILE")
+		}
+		return NewFileMailer(path, from)
+	case "":
+		return nil, fmt.Errorf("MAIL_DRIVER is not set, use smtp, file or stdout")
+	case "stdout":
+		log.Print("MAIL_DRIVER=stdout: emails, including password reset links, are written to the server log; do not use this in production")
+		return &WriterMailer{W: &lockedWriter{w: os.Stdout}, From: from}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+}
+
+// format renders msg as an RFC 5322 message with CRLF line endings.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// validHeader rejects values that would inject extra headers.
+func validHeader(values ...string) error {
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("mail header contains a line break")
+		}
+	}
+	return nil
+}
+
+// WriterMailer writes each message to W, separated by a blank line. It is
+// meant for development and tests.
+type WriterMailer struct {
+	W    io.Writer
+	From string
+}
+
+func (m *WriterMailer) Send(ctx context.Context, msg Message) error {
+	if err := validHeader(msg.To, msg.Subject); err != nil {
+		return err
+	}
+	_, err := m.W.Write(append(format(m.From, msg), '\r', '\n'))
+	return err
+}
+
+// NewFileMailer appends messages to the file at path.
+func NewFileMailer(path, from string) (*WriterMailer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterMailer{W: &lockedWriter{w: f}, From: from}, nil
+}
+
+// lockedWriter serializes writes so concurrent messages do not interleave.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,130 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts one message on a local port and returns what it received.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch verb := strings.ToUpper(strings.Fields(line + " x")[0]); verb {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250 localhost")
+			case "MAIL", "RCPT":
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				received <- string(data)
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	m := &SMTPMailer{Addr: addr, From: "sso@example.com"}
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Reset", Body: "line one\nline two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := <-received
+	for _, want := range []string{"From: sso@example.com", "To: user@example.com", "Subject: Reset", "line one\nline two"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("message missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestWriterMailerRejectsHeaderInjection(t *testing.T) {
+	var buf bytes.Buffer
+	m := &WriterMailer{W: &buf, From: "sso@example.com"}
+	err := m.Send(context.Background(), Message{To: "user@example.com\r\nBcc: evil@example.com", Subject: "Reset"})
+	if err == nil {
+		t.Fatal("expected an error for a header with a line break")
+	}
+	if err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Reset", Body: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	r := textproto.NewReader(bufio.NewReader(&buf))
+	header, err := r.ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get("To"); got != "user@example.com" {
+		t.Fatalf("To = %q", got)
+	}
+}
+
+func TestFromEnvRequiresDriver(t *testing.T) {
+	t.Setenv("MAIL_DRIVER", "")
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("expected an error when MAIL_DRIVER is not set")
+	}
+	t.Setenv("MAIL_DRIVER", "stdout")
+	if _, err := FromEnv(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSMTPMailerHonoursDeadline(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		// Accept and never greet, like a relay that has stopped responding.
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	m := &SMTPMailer{Addr: ln.Addr().String(), From: "sso@example.com"}
+	start := time.Now()
+	if err := m.Send(ctx, Message{To: "user@example.com", Subject: "Reset", Body: "x"}); err == nil {
+		t.Fatal("Send to a stalled server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Send took %s despite a 100ms deadline", elapsed)
+	}
+}
@@ -1,20 +1,48 @@
 package middleware
 
 import (
-	"crypto/rsa"
+	"context"
 	"sso-server/internal/helper"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware(publicKey *rsa.PublicKey) fiber.Handler {
+// Denylist reports whether a token has been revoked before its expiry.
+// helper.TokenDenylist implements it on top of Redis.
+type Denylist interface {
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// AuthMiddleware verifies the bearer token and stores it in c.Locals("user").
+// denylist may be nil when revocations need not be checked. Services outside
+// the SSO server cannot import this package; they use Authenticate from
+// sso-server/pkg/middleware instead.
+func AuthMiddleware(keys *helper.KeySet, denylist Denylist) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		tokenString := strings.Split(c.Get("Authorization"), "Bearer ")[1]
-		token, err := helper.VerifyToken(tokenString, publicKey)
+		tokenString, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+		if !ok || tokenString == "" {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="sso-server"`)
+			return c.Status(401).JSON(fiber.Map{"message": "Missing bearer token"})
+		}
+		token, err := helper.VerifyToken(tokenString, keys)
 		if err != nil || !token.Valid {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="sso-server", error="invalid_token"`)
 			return c.Status(401).JSON(fiber.Map{"message": "Invalid token"})
 		}
+		if denylist != nil {
+			claims, _ := token.Claims.(jwt.MapClaims)
+			jti, _ := claims["jti"].(string)
+			revoked, err := denylist.IsRevoked(c.Context(), jti)
+			if err != nil {
+				return c.Status(503).JSON(fiber.Map{"message": "Could not verify token status"})
+			}
+			if revoked {
+				c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="sso-server", error="invalid_token"`)
+				return c.Status(401).JSON(fiber.Map{"message": "Token has been revoked"})
+			}
+		}
 		c.Locals("user", token)
 
 		return c.Next()
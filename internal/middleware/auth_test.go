@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestAuthMiddlewareRejectsIDTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key. Err: %v", err)
+	}
+	keys, err := helper.NewKeySet(time.Hour, &helper.SigningKey{PrivateKey: key})
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+	user := models.User{ID: uuid.New(), Email: "reader@example.com"}
+	accessToken, err := helper.GenerateToken(user, helper.TokenGrant{ClientID: "blog"}, keys)
+	if err != nil {
+		t.Fatalf("error signing access token. Err: %v", err)
+	}
+	idToken, err := helper.GenerateIDToken(user, helper.IDTokenRequest{ClientID: "blog", AuthTime: time.Now()}, keys)
+	if err != nil {
+		t.Fatalf("error signing ID token. Err: %v", err)
+	}
+
+	app := fiber.New()
+	app.Get("/", AuthMiddleware(keys, nil), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusNoContent)
+	})
+	for token, want := range map[string]int{accessToken: http.StatusNoContent, idToken: http.StatusUnauthorized} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("error making request. Err: %v", err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("expected status %d; got %d", want, resp.StatusCode)
+		}
+	}
+}
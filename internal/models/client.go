@@ -0,0 +1,61 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Client struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ClientID     string    `gorm:"type:varchar(100);uniqueIndex;not null"`
+	Name         string    `gorm:"type:varchar(255);not null"`
+	SecretHash   string
+	RedirectURIs []string `gorm:"serializer:json"`
+	GrantTypes   []string `gorm:"serializer:json"`
+	Public       bool     `gorm:"not null;default:false"`
+	// FirstParty clients belong to us and skip the consent screen.
+	FirstParty bool `gorm:"not null;default:false"`
+	// RequireVerifiedEmail refuses sign-in to users who have not verified
+	// their email address yet.
+	RequireVerifiedEmail bool `gorm:"not null;default:false"`
+	// Scopes and Permissions are what the client itself is granted when it
+	// authenticates with the client_credentials grant.
+	Scopes      []string     `gorm:"serializer:json"`
+	Permissions []Permission `gorm:"many2many:client_permissions;"`
+	// Audiences are the services (permission slug prefixes such as "blog")
+	// whose user permissions may appear in this client's access tokens.
+	Audiences []string `gorm:"serializer:json"`
+	// AccessTokenClaims selects the optional access token claims. Empty
+	// means the defaults.
+	AccessTokenClaims []string `gorm:"serializer:json"`
+	// PostLogoutRedirectURIs are the only targets the end session endpoint
+	// will send the browser back to.
+	PostLogoutRedirectURIs []string `gorm:"serializer:json"`
+	// BackchannelLogoutURI receives a signed logout token when a session the
+	// client took part in ends.
+	BackchannelLogoutURI string `gorm:"type:varchar(2048)"`
+	// FrontchannelLogoutURI is loaded in a hidden iframe on the logout page
+	// with iss and sid, for clients that can only clear browser cookies.
+	FrontchannelLogoutURI string `gorm:"type:varchar(2048)"`
+	// UserInfoSignedResponseAlg makes /userinfo answer with a signed JWT
+	// instead of JSON when set, as in OIDC dynamic registration metadata.
+	UserInfoSignedResponseAlg string `gorm:"type:varchar(20)"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// AllowsRedirectURI reports whether uri exactly matches one of the registered redirect URIs.
+func (c Client) AllowsRedirectURI(uri string) bool {
+	return uri != "" && slices.Contains(c.RedirectURIs, uri)
+}
+
+func (c Client) AllowsPostLogoutRedirectURI(uri string) bool {
+	return uri != "" && slices.Contains(c.PostLogoutRedirectURIs, uri)
+}
+
+func (c Client) AllowsGrantType(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Grant records the scopes a user has approved for a client on the consent
+// screen.
+type Grant struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_grant_user_client"`
+	ClientID  string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_grant_user_client"`
+	Scopes    []string  `gorm:"serializer:json"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Covers reports whether every scope in scopes has already been granted.
+func (g Grant) Covers(scopes []string) bool {
+	for _, s := range scopes {
+		if !slices.Contains(g.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	LogoutDeliveryPending   = "pending"
+	LogoutDeliveryDelivered = "delivered"
+	LogoutDeliveryFailed    = "failed"
+)
+
+// LogoutDelivery logs one back-channel logout notification to a client so
+// failed deliveries can be inspected.
+type LogoutDelivery struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ClientID    string    `gorm:"type:varchar(100);index;not null"`
+	UserID      string    `gorm:"type:varchar(36);index"`
+	SessionID   string    `gorm:"type:varchar(36);index"`
+	URI         string    `gorm:"type:varchar(2048);not null"`
+	Status      string    `gorm:"type:varchar(20);index;not null"`
+	Attempts    int       `gorm:"not null;default:0"`
+	StatusCode  int
+	LastError   string
+	DeliveredAt *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
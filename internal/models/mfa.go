@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TOTPCredential is a user's authenticator app. It only counts as a second
+// factor once ConfirmedAt is set, i.e. after the user entered a code from it.
+type TOTPCredential struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex"`
+	Secret      string    `gorm:"type:varchar(64);not null"`
+	ConfirmedAt *time.Time
+	// LastCounter is the time step of the last accepted code; codes from that
+	// step or earlier are refused so a code cannot be replayed.
+	LastCounter int64 `gorm:"not null;default:0"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// RecoveryCode is a single-use code that replaces the authenticator app.
+// Only its hash is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	CodeHash  string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken stores the SHA-256 hash of an opaque refresh token. Every
+// rotation creates a new row in the same family; presenting a token whose
+// UsedAt is already set revokes the whole family.
+type RefreshToken struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+	FamilyID  uuid.UUID `gorm:"type:uuid;index;not null"`
+	UserID    uuid.UUID `gorm:"type:uuid;index;not null"`
+	ClientID  string    `gorm:"type:varchar(100);index;not null"`
+	// SessionID is the sid of the SSO session the family was issued under,
+	// so ending the session can revoke it.
+	SessionID string `gorm:"type:varchar(36);index"`
+	// MFA records that the family was issued after a second factor.
+	MFA       bool `gorm:"not null;default:false"`
+	Scope     string
+	AuthTime  time.Time
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
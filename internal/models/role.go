@@ -10,6 +10,11 @@ type Role struct {
 	ID          uuid.UUID    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
 	Name        string       `gorm:"type:varchar(100);uniqueIndex;not null"`
 	Permissions []Permission `gorm:"many2many:role_permissions;"`
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// System roles are created by the seeder and referenced by name in code,
+	// so they cannot be renamed or deleted.
+	System bool `gorm:"not null;default:false"`
+	// RequireMFA makes members sign in with a second factor.
+	RequireMFA bool `gorm:"not null;default:false"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
 }
@@ -13,7 +13,22 @@ type User struct {
 	PasswordHash string    `gorm:"not null"`
 	RoleID       uuid.UUID `gorm:"type:uuid"`
 	Role         Role      `gorm:"foreignKey:RoleID"`
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	// EmailVerifiedAt is set once the user has followed the verification link
+	// sent to Email.
+	EmailVerifiedAt *time.Time
+	// DisabledAt is set while an administrator has locked the account.
+	DisabledAt *time.Time
+	// PasswordResetRequired blocks sign-in until the password is reset.
+	PasswordResetRequired bool `gorm:"not null;default:false"`
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+	DeletedAt             gorm.DeletedAt `gorm:"index"`
+}
+
+func (u User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+func (u User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
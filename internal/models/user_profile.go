@@ -7,9 +7,17 @@ import (
 )
 
 type UserProfile struct {
-	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null"`
-	FullName  string    `gorm:"type:varchar(255);not null"`
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null"`
+	FullName    string    `gorm:"type:varchar(255);not null"`
+	DisplayName string    `gorm:"type:varchar(100)"`
+	AvatarURL   string    `gorm:"type:varchar(2048)"`
+	// Locale is a BCP 47 language tag such as "en-US".
+	Locale string `gorm:"type:varchar(35)"`
+	// Timezone is an IANA time zone name such as "Asia/Jakarta".
+	Timezone string `gorm:"type:varchar(64)"`
+	// Phone is in E.164 format.
+	Phone     string    `gorm:"type:varchar(20)"`
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 }
@@ -2,8 +2,14 @@ package server
 
 import (
 	"log"
+	"os"
 	"sso-server/internal/controllers"
 	"sso-server/internal/database"
+	"sso-server/internal/helper"
+	"sso-server/internal/mail"
+	"sso-server/internal/middleware"
+	authz "sso-server/pkg/middleware"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -21,20 +27,89 @@ func (s *FiberServer) RegisterFiberRoutes() {
 
 	s.App.Get("/", s.HelloWorldHandler)
 	db := database.New().GetDB()
+	forbidPlainPKCE, _ := strconv.ParseBool(os.Getenv("PKCE_FORBID_PLAIN"))
+	denylist := &helper.TokenDenylist{Redis: s.db.GetRedis()}
+	mailer, err := mail.FromEnv()
+	if err != nil {
+		log.Fatal("Could not configure mail delivery: ", err)
+	}
 	authControllers := &controllers.AuthController{
-		DB:         db,
-		PrivateKey: s.PrivateKey,
-		Redis:      s.db.GetRedis(),
+		DB:              db,
+		Keys:            s.Keys,
+		Redis:           s.db.GetRedis(),
+		Denylist:        denylist,
+		Mailer:          mailer,
+		ForbidPlainPKCE: forbidPlainPKCE,
 	}
 	s.App.Post("/register/reader", authControllers.ReaderRegister)
 	s.App.Post("/register/editor", authControllers.EditorRegister)
-	if s.PublicKey == nil {
-		log.Fatal("CRITICAL: RSA Public Key is nil. Check Your Configuration")
+	if s.Keys == nil {
+		log.Fatal("CRITICAL: signing key set is nil. Check Your Configuration")
 	}
 	s.App.Post("/login", authControllers.Login)
 	s.App.Get("/login", authControllers.ShowLogin)
 	s.App.Get("/register/reader", authControllers.ShowRegister)
 	s.App.Post("/exchange", authControllers.ExchangeCode)
+	s.App.Get("/forgot-password", authControllers.ShowForgotPassword)
+	s.App.Post("/forgot-password", authControllers.ForgotPassword)
+	s.App.Get("/reset-password", authControllers.ShowResetPassword)
+	s.App.Post("/reset-password", authControllers.ResetPassword)
+	s.App.Get("/verify-email", authControllers.VerifyEmail)
+	s.App.Post("/verify-email/resend", authControllers.ResendVerification)
+	s.App.Get("/confirm-email-change", authControllers.ConfirmEmailChange)
+	s.App.Get("/account", authControllers.ShowAccount)
+	s.App.Post("/account", authControllers.SaveAccount)
+	s.App.Post("/account/login", authControllers.AccountLogin)
+	s.App.Get("/mfa", authControllers.ShowSecondFactor)
+	s.App.Post("/mfa", authControllers.VerifySecondFactor)
+	s.App.Get("/authorize", authControllers.ShowAuthorize)
+	s.App.Post("/authorize", authControllers.Authorize)
+	s.App.Post("/authorize/consent", authControllers.Consent)
+	s.App.Post("/token", authControllers.Token)
+	s.App.Get("/.well-known/openid-configuration", authControllers.Discovery)
+	s.App.Get("/.well-known/jwks.json", authControllers.JWKS)
+	s.App.Get("/logout", authControllers.EndSession)
+	s.App.Post("/logout", authControllers.EndSession)
+	s.App.Post("/revoke", authControllers.Revoke)
+	s.App.Post("/introspect", authControllers.Introspect)
+	requireAuth := middleware.AuthMiddleware(s.Keys, denylist)
+	s.App.Get("/userinfo", requireAuth, authControllers.UserInfo)
+	s.App.Post("/userinfo", requireAuth, authControllers.UserInfo)
+	s.App.Get("/me/grants", requireAuth, authControllers.ListGrants)
+	s.App.Delete("/me/grants/:client_id", requireAuth, authControllers.RevokeGrant)
+	s.App.Post("/me/password", requireAuth, authControllers.ChangePassword)
+	s.App.Post("/me/email", requireAuth, authControllers.ChangeEmail)
+	s.App.Get("/me/profile", requireAuth, authControllers.GetProfile)
+	s.App.Patch("/me/profile", requireAuth, authControllers.UpdateProfile)
+	s.App.Get("/me/mfa", requireAuth, authControllers.MFAStatus)
+	s.App.Post("/me/mfa/totp", requireAuth, authControllers.StartTOTPEnrollment)
+	s.App.Post("/me/mfa/totp/confirm", requireAuth, authControllers.ConfirmTOTPEnrollment)
+	s.App.Delete("/me/mfa/totp", requireAuth, authControllers.DisableTOTP)
+	s.App.Post("/me/mfa/recovery-codes", requireAuth, authControllers.RegenerateRecoveryCodes)
+
+	adminControllers := &controllers.AdminController{DB: db, Auth: authControllers}
+	admin := s.App.Group("/admin", requireAuth, authz.RequireAnyRole("Administrator"))
+	admin.Get("/roles", adminControllers.ListRoles)
+	admin.Post("/roles", adminControllers.CreateRole)
+	admin.Get("/roles/:id", adminControllers.GetRole)
+	admin.Patch("/roles/:id", adminControllers.RenameRole)
+	admin.Delete("/roles/:id", adminControllers.DeleteRole)
+	admin.Put("/roles/:id/permissions/:permission_id", adminControllers.AttachPermission)
+	admin.Delete("/roles/:id/permissions/:permission_id", adminControllers.DetachPermission)
+	admin.Put("/roles/:id/mfa", adminControllers.SetRoleMFA)
+	admin.Get("/permissions", adminControllers.ListPermissions)
+	admin.Post("/permissions", adminControllers.CreatePermission)
+	admin.Patch("/permissions/:id", adminControllers.UpdatePermission)
+	admin.Delete("/permissions/:id", adminControllers.DeletePermission)
+	admin.Get("/users", adminControllers.ListUsers)
+	admin.Get("/users/:id", adminControllers.GetUser)
+	admin.Delete("/users/:id", adminControllers.DeleteUser)
+	admin.Put("/users/:id/role", adminControllers.ChangeUserRole)
+	admin.Post("/users/:id/disable", adminControllers.DisableUser)
+	admin.Post("/users/:id/enable", adminControllers.EnableUser)
+	admin.Post("/users/:id/restore", adminControllers.RestoreUser)
+	admin.Post("/users/:id/password-reset", adminControllers.ForcePasswordReset)
+	admin.Delete("/users/:id/mfa", adminControllers.ResetUserMFA)
 	s.App.Get("/health", s.healthHandler)
 
 }
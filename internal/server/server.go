@@ -1,23 +1,21 @@
 package server
 
 import (
-	"crypto/rsa"
-
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/template/html/v2"
 
 	"sso-server/internal/database"
+	"sso-server/internal/helper"
 )
 
 type FiberServer struct {
 	*fiber.App
-	db         database.Service
-	PrivateKey *rsa.PrivateKey
-	PublicKey  *rsa.PublicKey
+	db   database.Service
+	Keys *helper.KeySet
 }
 
-func New(privKey *rsa.PrivateKey, pubKey *rsa.PublicKey) *FiberServer {
+func New(keys *helper.KeySet) *FiberServer {
 	engine := html.New("./resources/views", ".html")
 	server := &FiberServer{
 		App: fiber.New(fiber.Config{
@@ -25,9 +23,8 @@ func New(privKey *rsa.PrivateKey, pubKey *rsa.PublicKey) *FiberServer {
 			AppName:      "sso-server",
 			Views:        engine,
 		}),
-		PrivateKey: privKey,
-		PublicKey:  pubKey,
-		db:         database.New(),
+		Keys: keys,
+		db:   database.New(),
 	}
 	server.App.Use(logger.New(logger.Config{
 		Format: "[${ip}]:${port} ${status} - ${method} ${path}\n",
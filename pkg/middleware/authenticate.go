@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"crypto"
+	"sso-server/internal/helper"
+	authn "sso-server/internal/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PublicKey is one of the SSO server's verification keys, as published in
+// its JWKS or distributed as a PEM file.
+type PublicKey struct {
+	// ID is the key's kid. It defaults to the key's RFC 7638 thumbprint,
+	// which is also what the SSO server uses unless configured otherwise.
+	ID string
+	// Algorithm defaults to RS256 for RSA keys, ES256 for P-256 keys and
+	// EdDSA for Ed25519 keys.
+	Algorithm string
+	Key       crypto.PublicKey
+}
+
+// KeySet holds the public keys a service accepts access tokens from.
+type KeySet struct {
+	keys *helper.KeySet
+}
+
+// NewKeySet builds the key set for Authenticate. Pass every key the SSO
+// server currently publishes so tokens keep verifying across a rotation.
+func NewKeySet(keys ...PublicKey) (*KeySet, error) {
+	signingKeys := make([]*helper.SigningKey, 0, len(keys))
+	for _, k := range keys {
+		signingKeys = append(signingKeys, &helper.SigningKey{ID: k.ID, Algorithm: k.Algorithm, PublicKey: k.Key})
+	}
+	ks, err := helper.NewKeySet(0, signingKeys...)
+	if err != nil {
+		return nil, err
+	}
+	return &KeySet{keys: ks}, nil
+}
+
+// ParsePublicKeyPEM reads a PKIX or PKCS#1 public key, or the public key of
+// a certificate.
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	return helper.ParsePublicKeyPEM(data)
+}
+
+// Authenticate verifies the bearer token against keys the same way the SSO
+// server does and stores it in c.Locals("user") for the Require guards.
+// Revocation before expiry is not checked since that needs the SSO server's
+// Redis; call its introspection endpoint where that matters.
+func Authenticate(keys *KeySet) fiber.Handler {
+	return authn.AuthMiddleware(keys.keys, nil)
+}
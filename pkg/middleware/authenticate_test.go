@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http/httptest"
+	"sso-server/internal/helper"
+	"sso-server/internal/models"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestAuthenticate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key. Err: %v", err)
+	}
+	server, err := helper.NewKeySet(time.Hour, &helper.SigningKey{PrivateKey: key})
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+	token, err := helper.GenerateToken(models.User{ID: uuid.New()}, helper.TokenGrant{
+		ClientID:    "blog",
+		Permissions: []string{"blog:write"},
+	}, server)
+	if err != nil {
+		t.Fatalf("error signing token. Err: %v", err)
+	}
+
+	keys, err := NewKeySet(PublicKey{Key: &key.PublicKey})
+	if err != nil {
+		t.Fatalf("error building key set. Err: %v", err)
+	}
+	app := fiber.New()
+	app.Get("/", Authenticate(keys), RequirePermission("blog:write"), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	for header, want := range map[string]int{"Bearer " + token: 200, "Bearer " + token + "x": 401, "": 401} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("%.20q: expected status %d; got %d", header, want, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Package middleware provides authorization guards for Fiber services that
+// accept access tokens from the SSO server. They run after a middleware that
+// has verified the bearer token and stored the *jwt.Token in
+// c.Locals("user"), such as Authenticate or the SSO server's own
+// AuthMiddleware.
+package middleware
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RequirePermission allows the request when the token's permissions claim
+// contains every one of permissions.
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := tokenClaims(c)
+		if !ok {
+			return unauthenticated(c)
+		}
+		granted := stringsClaim(claims, "permissions")
+		for _, p := range permissions {
+			if !slices.Contains(granted, p) {
+				return forbidden(c, "Missing permission "+p)
+			}
+		}
+		return c.Next()
+	}
+}
+
+// RequireAnyRole allows the request when the token's role claim is one of
+// roles. Client tokens carry no role and are always rejected.
+func RequireAnyRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := tokenClaims(c)
+		if !ok {
+			return unauthenticated(c)
+		}
+		role, _ := claims["role"].(string)
+		if role == "" || !slices.Contains(roles, role) {
+			return forbidden(c, "Requires one of the roles: "+strings.Join(roles, ", "))
+		}
+		return c.Next()
+	}
+}
+
+// RequireScope allows the request when the token was granted every one of
+// scopes. Rejections carry an RFC 6750 insufficient_scope challenge.
+func RequireScope(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := tokenClaims(c)
+		if !ok {
+			return unauthenticated(c)
+		}
+		scope, _ := claims["scope"].(string)
+		granted := strings.Fields(scope)
+		for _, s := range scopes {
+			if !slices.Contains(granted, s) {
+				c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="sso-server", error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+				return forbidden(c, "Missing scope "+s)
+			}
+		}
+		return c.Next()
+	}
+}
+
+func tokenClaims(c *fiber.Ctx) (jwt.MapClaims, bool) {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok || token == nil || !token.Valid {
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	return claims, ok
+}
+
+// stringsClaim reads a JSON array claim. Parsed tokens hold []interface{};
+// tokens built in-process may hold []string.
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func unauthenticated(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="sso-server"`)
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Missing bearer token"})
+}
+
+func forbidden(c *fiber.Ctx, message string) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error":   "forbidden",
+		"message": message,
+	})
+}
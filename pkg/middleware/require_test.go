@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newApp(claims jwt.MapClaims, guard fiber.Handler) *fiber.App {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if claims != nil {
+			c.Locals("user", &jwt.Token{Claims: claims, Valid: true})
+		}
+		return c.Next()
+	}, guard, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func TestGuards(t *testing.T) {
+	claims := jwt.MapClaims{
+		"role":        "Administrator",
+		"scope":       "openid blog",
+		"permissions": []interface{}{"blog:read", "blog:write"},
+	}
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		guard  fiber.Handler
+		want   int
+	}{
+		{"permission granted", claims, RequirePermission("blog:write"), 200},
+		{"permission missing", claims, RequirePermission("library:write"), 403},
+		{"role allowed", claims, RequireAnyRole("Editor", "Administrator"), 200},
+		{"role rejected", claims, RequireAnyRole("Editor"), 403},
+		{"scope granted", claims, RequireScope("blog"), 200},
+		{"scope missing", claims, RequireScope("blog", "library"), 403},
+		{"no token", nil, RequirePermission("blog:read"), 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := newApp(tt.claims, tt.guard).Test(httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}